@@ -0,0 +1,115 @@
+package cache
+
+import (
+	"sync"
+	"sync/atomic"
+)
+
+// Budget caps the combined size of several caches, which may hold different value types.
+// Each cache registered with Config.Budget reports its size changes to the budget, and when
+// the combined size exceeds the limit, the largest cache evicts its least recently used items.
+// This lets caches trade space while the aggregate stays bounded.
+type Budget struct {
+	limit   int64
+	used    atomic.Int64
+	mu      sync.Mutex
+	members []*budgetMember
+}
+
+// budgetMember is the registration of a single cache with a budget.
+type budgetMember struct {
+	used    atomic.Int64
+	reclaim chan struct{}
+}
+
+// NewBudget returns a budget limiting the combined size of its caches to limit.
+func NewBudget(limit int) *Budget {
+	return &Budget{limit: int64(limit)}
+}
+
+// Limit returns the combined size the budget allows.
+func (b *Budget) Limit() int {
+	return int(b.limit)
+}
+
+// Used returns the combined size of the caches registered with the budget.
+func (b *Budget) Used() int {
+	return int(b.used.Load())
+}
+
+func (b *Budget) register() *budgetMember {
+	m := &budgetMember{reclaim: make(chan struct{}, 1)}
+	b.mu.Lock()
+	b.members = append(b.members, m)
+	b.mu.Unlock()
+	return m
+}
+
+func (b *Budget) unregister(m *budgetMember) {
+	b.mu.Lock()
+	for i, member := range b.members {
+		if member == m {
+			b.members = append(b.members[:i], b.members[i+1:]...)
+			break
+		}
+	}
+	b.mu.Unlock()
+	b.used.Add(-m.used.Swap(0))
+}
+
+func (b *Budget) add(m *budgetMember, size int) {
+	m.used.Add(int64(size))
+	b.used.Add(int64(size))
+}
+
+func (b *Budget) exceeded() bool {
+	return b.used.Load() > b.limit
+}
+
+// largest returns the member using the most space.
+func (b *Budget) largest() *budgetMember {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	var largest *budgetMember
+	for _, m := range b.members {
+		if largest == nil || m.used.Load() > largest.used.Load() {
+			largest = m
+		}
+	}
+	return largest
+}
+
+// signal asks the member's worker to evict items until the budget is no longer exceeded.
+// A pending request is enough, so the signal is dropped if one is already queued.
+func (m *budgetMember) signal() {
+	select {
+	case m.reclaim <- struct{}{}:
+	default:
+	}
+}
+
+// reclaimBudget makes room in an exceeded budget. If the worker's cache is the largest member,
+// the worker evicts its own items, otherwise it asks the largest member to do so.
+func (w *worker[K, V]) reclaimBudget() {
+	c := w.cache
+	if c.budget == nil || !c.budget.exceeded() {
+		return
+	}
+	if largest := c.budget.largest(); largest != nil && largest != c.budgetMember {
+		largest.signal()
+		return
+	}
+	w.trimBudget()
+}
+
+// trimBudget evicts items chosen by the worker's eviction policy until the budget is no longer exceeded.
+// With several workers, the one receiving the signal only evicts its own items.
+func (w *worker[K, V]) trimBudget() {
+	for w.cache.budget.exceeded() {
+		item := w.policy.victim()
+		if item == nil {
+			return
+		}
+		w.evict(item)
+	}
+}
@@ -0,0 +1,46 @@
+package cache_test
+
+import (
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/mcheviron/cache"
+)
+
+func TestBudgetSharedAcrossCaches(t *testing.T) {
+	budget := cache.NewBudget(100)
+	strings := cache.New(cache.NewConfig[string, string]().MaxSize(1000).Budget(budget).
+		Weigher(func(string) int { return 1 }))
+	defer strings.Close()
+	ints := cache.New(cache.NewConfig[string, int]().MaxSize(1000).Budget(budget).
+		Weigher(func(int) int { return 1 }))
+	defer ints.Close()
+
+	for i := range 100 {
+		strings.Set("key"+strconv.Itoa(i), "value", time.Minute)
+	}
+	waitFor(func() bool { return budget.Used() == 100 })
+
+	if used := budget.Used(); used != 100 {
+		t.Errorf("Expected budget usage to be 100, got %d", used)
+	}
+
+	for i := range 60 {
+		ints.Set("key"+strconv.Itoa(i), i, time.Minute)
+		time.Sleep(time.Millisecond)
+	}
+	time.Sleep(10 * time.Millisecond)
+
+	if used := budget.Used(); used > 100 {
+		t.Errorf("Expected budget usage to stay within 100, got %d", used)
+	}
+
+	if count := ints.ItemCount(); count < 40 {
+		t.Errorf("Expected the second cache to gain space, got %d items", count)
+	}
+
+	if count := strings.ItemCount(); count > 60 {
+		t.Errorf("Expected the first cache to give up space, got %d items", count)
+	}
+}
@@ -1,42 +1,104 @@
 package cache
 
 import (
-	"hash/fnv"
+	"container/heap"
+	"fmt"
+	"math"
+	"math/rand/v2"
+	"reflect"
+	"runtime"
+	"slices"
 	"strings"
+	"sync"
+	"sync/atomic"
 	"time"
 )
 
-type Cache[T any] struct {
-	*Config
-	queue       *queue[*Item[T]]
-	shards      []*shard[T]
-	size        int
-	shardMask   uint32
-	deletables  chan *Item[T]
-	promotables chan *Item[T]
-	freeList    freeList[T]
-}
-
-func New[T any](config *Config) *Cache[T] {
-	c := &Cache[T]{
-		queue:       newQueue[*Item[T]](),
-		Config:      config,
-		shardMask:   uint32(config.shards) - 1,
-		shards:      make([]*shard[T], config.shards),
-		deletables:  make(chan *Item[T], config.deleteBuffer),
-		promotables: make(chan *Item[T], config.promoteBuffer),
-		freeList:    newFreeList[T](config.maxSize / config.freeListSize),
+type Cache[K comparable, V any] struct {
+	*Config[K, V]
+	shards          []*shard[K, V]
+	workers         []*worker[K, V]
+	limit           atomic.Int64
+	shardMask       uint32
+	scans           chan struct{}
+	stats           stats
+	loads           group[K, V]
+	revalidating    sync.Map
+	done            chan struct{}
+	closeOnce       sync.Once
+	closing         atomic.Bool
+	writes          sync.RWMutex
+	running         sync.WaitGroup
+	doMu            sync.Mutex
+	weigher         func(value V) int
+	weights         *weightMemo[V]
+	budget          *Budget
+	budgetMember    *budgetMember
+	lastLoadFailure atomic.Int64
+	hash            func(key K) uint32
+}
+
+func New[K comparable, V any](config *Config[K, V]) *Cache[K, V] {
+	config, err := config.Build()
+	if err != nil {
+		panic(err)
+	}
+	c := &Cache[K, V]{
+		Config:    config,
+		shardMask: uint32(config.shards) - 1,
+		shards:    make([]*shard[K, V], config.shards),
+		done:      make(chan struct{}),
+	}
+	c.limit.Store(int64(config.maxSize))
+	if config.maxScans > 0 {
+		c.scans = make(chan struct{}, config.maxScans)
+	}
+	c.weigher = config.weigher
+	c.hash = config.hashFunc
+	if c.hash == nil {
+		c.hash = defaultHash[K]()
+	}
+	if config.byCount {
+		c.weigher = func(V) int { return 1 }
+	} else if config.memoizeWeight {
+		c.weights = newWeightMemo[V]()
 	}
 	for i := range c.shards {
-		c.shards[i] = &shard[T]{
-			store: make(map[string]*Item[T]),
+		c.shards[i] = &shard[K, V]{
+			store: make(map[K]*Item[K, V]),
+		}
+		if config.shardCounters {
+			c.shards[i].counters = &shardCounters{}
+		}
+		if config.ttlJitter > 0 {
+			c.shards[i].rand = rand.New(rand.NewPCG(rand.Uint64(), rand.Uint64()))
+		}
+	}
+	if config.budget != nil {
+		c.budget = config.budget
+		c.budgetMember = config.budget.register()
+	}
+	// Shard i belongs to worker i % workers, so each worker owns a disjoint set of shards.
+	c.workers = make([]*worker[K, V], config.workers)
+	for i := range c.workers {
+		var shards []*shard[K, V]
+		for j := i; j < len(c.shards); j += len(c.workers) {
+			shards = append(shards, c.shards[j])
 		}
+		c.workers[i] = newWorker(c, shards)
+	}
+	for _, w := range c.workers {
+		c.running.Add(1)
+		go w.run()
+	}
+	if config.pressure != nil {
+		c.running.Add(1)
+		go c.watchPressure(config.pressure)
 	}
-	go c.worker()
 	return c
 }
 
-func (c *Cache[T]) ItemCount() int {
+func (c *Cache[K, V]) ItemCount() int {
 	count := 0
 	for _, b := range c.shards {
 		count += b.itemCount()
@@ -44,178 +106,1151 @@ func (c *Cache[T]) ItemCount() int {
 	return count
 }
 
-func (c *Cache[T]) Get(key string) *Item[T] {
+// Size returns the total weight of the items in the cache, in bytes or in number of items
+// depending on the configuration. It is updated asynchronously by the worker goroutines.
+func (c *Cache[K, V]) Size() int {
+	var size int64
+	for _, w := range c.workers {
+		size += w.size.Load()
+	}
+	return int(size)
+}
+
+// MaxSizeValue returns the maximum size of the cache, in the same unit as Size.
+func (c *Cache[K, V]) MaxSizeValue() int {
+	return int(c.limit.Load())
+}
+
+// SetMaxSize changes the maximum size of the cache at runtime. Shrinking below the current size
+// evicts items right away, before SetMaxSize returns, while growing just raises the ceiling.
+// Non-positive sizes are ignored.
+func (c *Cache[K, V]) SetMaxSize(n int) {
+	if n <= 0 {
+		return
+	}
+	c.limit.Store(int64(n))
+	if c.Size() > n {
+		c.TrimToSize(n)
+	}
+}
+
+// Get returns the item for the key, which can be expired, or nil if it is missing
+// or stored as missing with SetMissing.
+//
+// With a configured Loader, a missing or expired key is loaded instead: Get then blocks
+// until the loader returns, sharing a single load with concurrent callers for the same key.
+// Keys stored as missing are not loaded until their tombstone expires.
+// If the loader fails, the error goes to the error handler and Get returns what it found, nil or expired.
+func (c *Cache[K, V]) Get(key K) *Item[K, V] {
+	key = c.normalizeKey(key)
+	item := c.get(key)
+	if item != nil && item.missing {
+		if !item.Expired() || c.loader == nil {
+			return nil
+		}
+		item = nil
+	}
+	if c.loader != nil && (item == nil || item.Expired()) {
+		if item != nil && c.inGrace(item) {
+			c.revalidate(key)
+			return item
+		}
+		return c.load(key, item)
+	}
+	return item
+}
+
+// get looks up an already normalized key, counting the hit or miss and promoting live items.
+// Tombstones are returned as they are and count as misses.
+func (c *Cache[K, V]) get(key K) *Item[K, V] {
 	item := c.getShard(key).get(key)
 	if item == nil {
+		c.stats.misses.Add(1)
 		return nil
 	}
-	if !item.Expired() {
-		select {
-		case c.promotables <- item:
-		default:
-		}
+	if item.Expired() || item.missing {
+		c.stats.misses.Add(1)
+		return item
+	}
+	c.stats.hits.Add(1)
+	item.access()
+	if c.slidingTTL {
+		item.slide()
+	}
+	if c.sampled() {
+		return item
+	}
+	c.tryPromote(item)
+	return item
+}
+
+// GetWithExpiry returns the value stored for the key and its remaining TTL, NoExpiration if it never expires.
+// It counts and promotes like Get, and reports false with zero values if the key is missing or expired.
+func (c *Cache[K, V]) GetWithExpiry(key K) (V, time.Duration, bool) {
+	item := c.Get(key)
+	if item == nil || item.Expired() {
+		var zero V
+		return zero, 0, false
+	}
+	return item.value, item.TTL(), true
+}
+
+// GetValue returns the value stored for the key, reporting false with the zero value if the key is missing or expired.
+// It counts, promotes and loads like Get.
+func (c *Cache[K, V]) GetValue(key K) (V, bool) {
+	item := c.Get(key)
+	if item == nil || item.Expired() {
+		var zero V
+		return zero, false
+	}
+	return item.value, true
+}
+
+// GetAndRefresh returns the item for the key after setting its expiration to now plus ttl, promoting it.
+// Both happen under the shard's lock, so the item cannot be removed between the lookup and the refresh.
+// It reports false with a nil item if the key is missing or expired, and counts hits and misses like Get.
+// The item keeps the TTL it was stored with for SlidingTTL and Touch.
+func (c *Cache[K, V]) GetAndRefresh(key K, ttl time.Duration) (*Item[K, V], bool) {
+	key = c.normalizeKey(key)
+	item := c.getShard(key).refresh(key, c.expiration(key, c.clampTTL(ttl)))
+	if item == nil {
+		c.stats.misses.Add(1)
+		return nil, false
+	}
+	c.stats.hits.Add(1)
+	item.access()
+	c.tryPromote(item)
+	return item, true
+}
+
+// Peek returns the item for the given key without promoting it, so inspecting
+// the cache does not affect the LRU ordering. Like Get, Peek can return expired items.
+func (c *Cache[K, V]) Peek(key K) *Item[K, V] {
+	key = c.normalizeKey(key)
+	return c.getShard(key).get(key)
+}
+
+// Has reports whether a non-expired item exists for the key, without promoting it.
+// Keys stored as missing with SetMissing are reported by GetMissing instead.
+func (c *Cache[K, V]) Has(key K) bool {
+	key = c.normalizeKey(key)
+	item := c.getShard(key).get(key)
+	return item != nil && !item.Expired() && !item.missing
+}
+
+// SetMissing stores a tombstone recording that the key is known to be missing, expiring after ttl,
+// so that Get and GetOrSet do not call their loader for it again until then.
+// A later Set, or any other write of a value, replaces the tombstone like any other item.
+// Tombstones weigh 1 and are seen by Peek as items whose Missing method reports true, and by Range
+// with the zero value; the other lookups and scans leave them out.
+func (c *Cache[K, V]) SetMissing(key K, ttl time.Duration) {
+	c.writes.RLock()
+	defer c.writes.RUnlock()
+	key = c.normalizeKey(key)
+	if err := c.admitKey(key); err != nil {
+		return
+	}
+	var zero V
+	ttl = c.clampTTL(ttl)
+	item := c.allocItem(key, zero, c.expiration(key, ttl), 1)
+	item.ttl = ttl
+	item.missing = true
+	c.store(item)
+}
+
+// GetMissing reports whether the key is stored as missing by a tombstone that has not expired yet.
+func (c *Cache[K, V]) GetMissing(key K) bool {
+	key = c.normalizeKey(key)
+	item := c.getShard(key).get(key)
+	return item != nil && item.missing && !item.Expired()
+}
+
+// Set stores the value for the key, expiring after the given duration.
+// A non-positive duration means the value never expires.
+func (c *Cache[K, V]) Set(key K, value V, duration time.Duration) {
+	c.set(key, value, duration)
+}
+
+// SetDefault stores the value for the key, expiring after the configured default TTL.
+func (c *Cache[K, V]) SetDefault(key K, value V) {
+	c.set(key, value, c.defaultTTL)
+}
+
+// SetWithResult stores the value like Set, but returns an error if it was rejected:
+// ErrKeyTooLong if the key is longer than the configured maximum length,
+// ErrItemTooLarge if the value weighs more than the configured maximum item size,
+// ErrCacheFull if it weighs more than the whole cache can hold,
+// ErrInvalidWeight if its weight is invalid and the configuration rejects invalid weights,
+// or ErrClosed if Close or DrainAndClose has been called.
+func (c *Cache[K, V]) SetWithResult(key K, value V, duration time.Duration) error {
+	_, err := c.set(key, value, duration)
+	return err
+}
+
+// SetWithSoftTTL stores the value with two expirations: after the soft TTL the item
+// reports Stale and should be refreshed, after the hard TTL it is expired.
+func (c *Cache[K, V]) SetWithSoftTTL(key K, value V, soft, hard time.Duration) {
+	c.writes.RLock()
+	defer c.writes.RUnlock()
+	if item, err := c.build(key, value, hard); err == nil {
+		item.stale = expiresAt(c.clock, soft)
+		c.store(item)
+	}
+}
+
+// SetWithExpireFunc stores the value like Set, and calls onExpire with the key and the value
+// once the item is removed from the cache after expiring. With a CleanupInterval, the janitor
+// removes it shortly after it expires; otherwise onExpire is only called when the expired item
+// is cleaned up by DeleteExpired or pruned to make room. onExpire is not called if the item
+// is deleted or replaced first. Like OnEvict, it runs on a worker goroutine and should return quickly.
+func (c *Cache[K, V]) SetWithExpireFunc(key K, value V, ttl time.Duration, onExpire func(key K, value V)) {
+	c.writes.RLock()
+	defer c.writes.RUnlock()
+	if item, err := c.build(key, value, ttl); err == nil {
+		item.onExpire = onExpire
+		c.store(item)
+	}
+}
+
+// SetWithSize stores the value like Set with the given weight, instead of weighing the value,
+// for callers that already know it, such as the length of a serialized value.
+// It returns ErrInvalidWeight if the size is negative, and otherwise the errors of SetWithResult.
+// With ByCount, every item counts as 1 whatever the given size.
+func (c *Cache[K, V]) SetWithSize(key K, value V, duration time.Duration, size int) error {
+	if size < 0 {
+		return fmt.Errorf("%w: size %d", ErrInvalidWeight, size)
+	}
+	if c.byCount {
+		size = 1
+	}
+	c.writes.RLock()
+	defer c.writes.RUnlock()
+	key = c.normalizeKey(key)
+	if err := c.admitKey(key); err != nil {
+		return err
+	}
+	if err := c.admitSize(size); err != nil {
+		return err
+	}
+	c.store(c.admitted(key, value, duration, size))
+	return nil
+}
+
+func (c *Cache[K, V]) set(key K, value V, duration time.Duration) (*Item[K, V], error) {
+	c.writes.RLock()
+	defer c.writes.RUnlock()
+	item, err := c.build(key, value, duration)
+	if err != nil {
+		return nil, err
+	}
+	c.store(item)
+	return item, nil
+}
+
+// build creates the item storing the value for the key.
+func (c *Cache[K, V]) build(key K, value V, duration time.Duration) (*Item[K, V], error) {
+	key = c.normalizeKey(key)
+	size, err := c.admit(key, value)
+	if err != nil {
+		return nil, err
+	}
+	item := c.admitted(key, value, duration, size)
+	c.holdWeight(item)
+	return item, nil
+}
+
+// admitted returns a new item for a value admitted with the given weight.
+// Released items are never reused, as callers and queued deletions may still reference them.
+func (c *Cache[K, V]) admitted(key K, value V, duration time.Duration, size int) *Item[K, V] {
+	duration = c.clampTTL(duration)
+	item := c.allocItem(key, value, c.expiration(key, duration), size)
+	item.ttl = duration
+	return item
+}
+
+// store puts the item in its shard, handing the item it replaces, if any, and the new item to the worker.
+func (c *Cache[K, V]) store(item *Item[K, V]) {
+	if old := c.getShard(item.key).set(item); old != nil {
+		c.discard(deletion[K, V]{item: old, notify: c.replaceNotifies(old, item.value), reason: Replaced})
 	}
+	c.promote(promotion[K, V]{item: item})
+}
+
+// clampTTL caps a duration to the configured MaxTTL, if any, and raises a positive duration
+// to the configured MinTTL. Durations that never expire are capped as well, but never raised.
+func (c *Cache[K, V]) clampTTL(duration time.Duration) time.Duration {
+	if c.maxTTL > 0 && (duration <= 0 || duration > c.maxTTL) {
+		return c.maxTTL
+	}
+	if duration > 0 && duration < c.minTTL {
+		return c.minTTL
+	}
+	return duration
+}
+
+// expiration returns the expiration time of an item stored for the given duration,
+// randomized by the configured TTL jitter using the random source of the key's shard.
+func (c *Cache[K, V]) expiration(key K, duration time.Duration) int64 {
+	if c.ttlJitter == 0 || duration <= 0 {
+		return expiresAt(c.clock, duration)
+	}
+	jittered := float64(duration) * (1 + c.ttlJitter*(2*c.getShard(key).random()-1))
+	if jittered < math.MaxInt64 {
+		duration = max(time.Duration(jittered), 1)
+	}
+	return expiresAt(c.clock, duration)
+}
+
+// newItem creates an item expiring at the given time, weighing its value.
+func (c *Cache[K, V]) newItem(key K, value V, expires int64) (*Item[K, V], error) {
+	size, err := c.admit(key, value)
+	if err != nil {
+		return nil, err
+	}
+	item := c.allocItem(key, value, expires, size)
+	c.holdWeight(item)
+	return item, nil
+}
+
+// holdWeight records the weight of a weighed item in the weight memo, if any,
+// until releaseWeight is called once the item has left the cache or was never stored.
+func (c *Cache[K, V]) holdWeight(item *Item[K, V]) {
+	if c.weights != nil {
+		c.weights.hold(item.value, item.size)
+		item.memoized = true
+	}
+}
+
+// releaseWeight drops the hold of an item on the weight memo, if it has one.
+func (c *Cache[K, V]) releaseWeight(item *Item[K, V]) {
+	if item.memoized {
+		c.weights.release(item.value)
+	}
+}
+
+// allocItem creates an item holding the settings of the cache that its methods need.
+func (c *Cache[K, V]) allocItem(key K, value V, expires int64, size int) *Item[K, V] {
+	item := newItem(key, value, expires, size)
+	item.copier = c.copier
+	item.clock = c.clock
 	return item
 }
 
-func (c *Cache[T]) Set(key string, value T, duration time.Duration) {
-	var newItem *Item[T]
-	if c.freeList.len() > 0 {
-		newItem = c.freeList.get()
-		newItem.reset(key, value, time.Now().Add(duration).UnixNano())
-	} else {
-		new, old := c.getShard(key).set(key, value, duration)
-		if old != nil {
-			c.deletables <- old
+// admit checks that the value can be stored for the key and returns its weight.
+// Keys longer than the configured maximum, values heavier than the maximum item size
+// and values that would not fit in the cache even if it was empty are rejected.
+// An invalid weight is reported to the error handler and either clamped to 0
+// or, if the configuration rejects invalid weights, returned as an error.
+func (c *Cache[K, V]) admit(key K, value V) (int, error) {
+	if err := c.admitKey(key); err != nil {
+		return 0, err
+	}
+	size, err := c.weigh(value)
+	if err != nil {
+		c.reportError(err)
+		if c.rejectInvalidWeights {
+			return 0, err
+		}
+	}
+	if err := c.admitSize(size); err != nil {
+		return 0, err
+	}
+	return size, nil
+}
+
+// admitKey checks that a value can be written for the key.
+func (c *Cache[K, V]) admitKey(key K) error {
+	if c.closing.Load() {
+		return ErrClosed
+	}
+	if err := c.checkKey(key); err != nil {
+		c.reportError(err)
+		return err
+	}
+	return nil
+}
+
+// admitSize checks that an item of the given weight fits in the cache, counting it as rejected otherwise.
+func (c *Cache[K, V]) admitSize(size int) error {
+	if c.maxItemSize > 0 && size > c.maxItemSize {
+		c.stats.rejected.Add(1)
+		return fmt.Errorf("%w: weight %d exceeds %d", ErrItemTooLarge, size, c.maxItemSize)
+	}
+	if limit := c.MaxSizeValue(); size > limit {
+		c.stats.rejected.Add(1)
+		return fmt.Errorf("%w: weight %d exceeds the max size %d", ErrCacheFull, size, limit)
+	}
+	return nil
+}
+
+// weigh computes the weight of a value, turning a panicking weigher or a negative weight into an error.
+// With MemoizeWeights, a value already held by an item of the cache is not weighed again.
+func (c *Cache[K, V]) weigh(value V) (size int, err error) {
+	if c.weights != nil {
+		if size, ok := c.weights.get(value); ok {
+			return size, nil
 		}
-		newItem = new
 	}
-	c.promotables <- newItem
+	defer func() {
+		if r := recover(); r != nil {
+			size, err = 0, fmt.Errorf("%w: weigher panicked: %v", ErrInvalidWeight, r)
+		}
+	}()
+	size = weigh(value, c.weigher)
+	if size < 0 {
+		return 0, fmt.Errorf("%w: weigher returned %d", ErrInvalidWeight, size)
+	}
+	return size, nil
 }
 
-func (c *Cache[T]) Delete(key string) {
+// reportError passes an error that cannot be returned to the caller to the error handler, if any.
+func (c *Cache[K, V]) reportError(err error) {
+	if c.errorHandler != nil {
+		c.errorHandler(err)
+	}
+}
+
+// SetNX stores the value only if the key is absent, expired or stored as missing, and reports whether it did.
+// The check and the insert happen atomically under the shard's lock.
+func (c *Cache[K, V]) SetNX(key K, value V, duration time.Duration) bool {
+	c.writes.RLock()
+	defer c.writes.RUnlock()
+	key = c.normalizeKey(key)
+	duration = c.clampTTL(duration)
+	item, err := c.newItem(key, value, c.expiration(key, duration))
+	if err != nil {
+		return false
+	}
+	item.ttl = duration
+	ok, old := c.getShard(key).setNX(item)
+	if !ok {
+		c.releaseWeight(item)
+		return false
+	}
+	if old != nil {
+		c.discard(deletion[K, V]{item: old, notify: c.replaceNotifies(old, value), reason: Replaced})
+	}
+	c.promote(promotion[K, V]{item: item})
+	return true
+}
+
+func (c *Cache[K, V]) Delete(key K) {
+	key = c.normalizeKey(key)
 	if item := c.getShard(key).delete(key); item != nil {
-		c.deletables <- item
+		c.discard(deletion[K, V]{item: item, notify: true, reason: Deleted})
 	}
 }
 
-func (c *Cache[T]) Replace(key string, value T) bool {
-	item := c.getShard(key).get(key)
+// GetAndDelete removes the item for the key and returns it, in a single step under the shard's lock,
+// so that concurrent callers cannot both get the same item. It reports false with a nil item if the key
+// is missing, expired or stored as missing with SetMissing; such an item is still removed.
+// The item goes through the OnEvict callback like with Delete.
+func (c *Cache[K, V]) GetAndDelete(key K) (*Item[K, V], bool) {
+	key = c.normalizeKey(key)
+	item := c.getShard(key).delete(key)
+	if item == nil {
+		return nil, false
+	}
+	c.discard(deletion[K, V]{item: item, notify: true, reason: Deleted})
+	if item.Expired() || item.missing {
+		return nil, false
+	}
+	return item, true
+}
+
+// SetMulti stores every value with the same duration, locking each shard once.
+// Values replaced or rejected are handled exactly like with Set.
+func (c *Cache[K, V]) SetMulti(values map[K]V, duration time.Duration) {
+	c.writes.RLock()
+	defer c.writes.RUnlock()
+	groups := make([][]*Item[K, V], len(c.shards))
+	duration = c.clampTTL(duration)
+	for key, value := range values {
+		key = c.normalizeKey(key)
+		item, err := c.newItem(key, value, c.expiration(key, duration))
+		if err != nil {
+			continue
+		}
+		item.ttl = duration
+		i := c.shardIndex(key)
+		groups[i] = append(groups[i], item)
+	}
+
+	for i, items := range groups {
+		if len(items) == 0 {
+			continue
+		}
+		replaced := c.shards[i].setMany(items)
+		for j, item := range items {
+			if old := replaced[j]; old != nil {
+				c.discard(deletion[K, V]{item: old, notify: c.replaceNotifies(old, item.value), reason: Replaced})
+			}
+			c.promote(promotion[K, V]{item: item})
+		}
+	}
+}
+
+// DeleteMulti removes every key, locking each shard once.
+func (c *Cache[K, V]) DeleteMulti(keys []K) {
+	groups := make([][]K, len(c.shards))
+	for _, key := range keys {
+		key = c.normalizeKey(key)
+		i := c.shardIndex(key)
+		groups[i] = append(groups[i], key)
+	}
+
+	for i, group := range groups {
+		if len(group) == 0 {
+			continue
+		}
+		for _, item := range c.shards[i].deleteMany(group) {
+			c.discard(deletion[K, V]{item: item, notify: true, reason: Deleted})
+		}
+	}
+}
+
+// TouchMany marks every present, non-expired key, tombstones aside, as recently used, moving it to the front of the queue.
+// Keys are looked up one shard at a time, and the number of keys found is returned.
+func (c *Cache[K, V]) TouchMany(keys []K) int {
+	found := 0
+	c.getMany(keys, func(key K, item *Item[K, V]) {
+		if item == nil || item.Expired() || item.missing {
+			return
+		}
+		found++
+		c.promote(promotion[K, V]{item: item, force: true})
+	})
+	return found
+}
+
+// GetMulti returns the items found for the given keys, keyed by the requested key.
+// Like Get, it returns expired items, leaves out tombstones and promotes the live items, but keys are looked up
+// with a single lock acquisition per shard and checked against a single reading of the clock,
+// which makes it cheaper than calling Get for each key. The order in which keys are looked up is unspecified.
+func (c *Cache[K, V]) GetMulti(keys []K) map[K]*Item[K, V] {
+	result := make(map[K]*Item[K, V], len(keys))
+	t := now(c.clock)
+	c.getMany(keys, func(key K, item *Item[K, V]) {
+		if item == nil || item.missing {
+			c.stats.misses.Add(1)
+			return
+		}
+		result[key] = item
+		if item.expiredAt(t) {
+			c.stats.misses.Add(1)
+			return
+		}
+		c.stats.hits.Add(1)
+		item.accessAt(t)
+		c.tryPromote(item)
+	})
+	return result
+}
+
+// lookup is a key looked up by getMany: the normalized key, its shard,
+// the index of the requested key and the item found for it.
+type lookup[K comparable, V any] struct {
+	key   K
+	shard uint32
+	index int
+	item  *Item[K, V]
+}
+
+// getMany looks up the keys one shard at a time and calls fn with each requested key
+// and its item, or nil if it is missing. fn is called outside of the shard locks.
+func (c *Cache[K, V]) getMany(keys []K, fn func(key K, item *Item[K, V])) {
+	// Order the keys by shard with a counting sort, so each shard is locked once. A single buffer holds
+	// the lookups in request order in its first half and ordered by shard in its second half.
+	buffer := make([]lookup[K, V], 2*len(keys))
+	unordered, lookups := buffer[:len(keys)], buffer[len(keys):]
+	var counts [64 + 1]int
+	offsets := counts[:]
+	if len(c.shards) >= len(counts) {
+		offsets = make([]int, len(c.shards)+1)
+	}
+	for i, key := range keys {
+		key = c.normalizeKey(key)
+		shard := c.shardIndex(key)
+		unordered[i] = lookup[K, V]{key: key, shard: shard, index: i}
+		offsets[shard+1]++
+	}
+	for i := range c.shards {
+		offsets[i+1] += offsets[i]
+	}
+	for _, l := range unordered {
+		lookups[offsets[l.shard]] = l
+		offsets[l.shard]++
+	}
+
+	for start := 0; start < len(lookups); {
+		end := start + 1
+		for end < len(lookups) && lookups[end].shard == lookups[start].shard {
+			end++
+		}
+		c.shards[lookups[start].shard].getMany(lookups[start:end])
+		start = end
+	}
+	for _, l := range lookups {
+		fn(keys[l.index], l.item)
+	}
+}
+
+// CompareAndSwap replaces the value for the key by new only if the current value equals old according to eq,
+// and reports whether it did. Missing and expired keys are never swapped. The comparison and the replacement
+// happen under the shard's lock, so concurrent swaps of the same key cannot both succeed.
+// The item keeps its expiration.
+func (c *Cache[K, V]) CompareAndSwap(key K, old, new V, eq func(a, b V) bool) bool {
+	return c.replace(key, new, func(existing *Item[K, V]) bool {
+		return eq(existing.value, old)
+	})
+}
+
+// Replace updates the value for the key, keeping its expiration, and reports whether it did.
+// Missing and expired keys are not replaced, so an expired item is never revived with a past TTL.
+func (c *Cache[K, V]) Replace(key K, value V) bool {
+	return c.replace(key, value, func(*Item[K, V]) bool {
+		return true
+	})
+}
+
+// replace swaps the live item for the key with a new item holding value and the same expiration,
+// if match accepts the current item. The lookup and the swap happen under the shard's lock,
+// and the replaced item is handed to the worker like with Set.
+func (c *Cache[K, V]) replace(key K, value V, match func(existing *Item[K, V]) bool) bool {
+	c.writes.RLock()
+	defer c.writes.RUnlock()
+	key = c.normalizeKey(key)
+	item, replaced := c.getShard(key).update(key, func(existing *Item[K, V]) *Item[K, V] {
+		if existing == nil || existing.Expired() || existing.missing || !match(existing) {
+			return nil
+		}
+		item, err := c.newItem(key, value, atomic.LoadInt64(&existing.expires))
+		if err != nil {
+			return nil
+		}
+		item.ttl = existing.ttl
+		return item
+	})
 	if item == nil {
 		return false
 	}
-	c.getShard(key).set(key, value, item.TTL())
+	c.discard(deletion[K, V]{item: replaced, notify: c.replaceNotifies(replaced, value), reason: Replaced})
+	c.promote(promotion[K, V]{item: item})
 	return true
 }
 
-func (c *Cache[T]) Extend(key string, duration time.Duration) bool {
+func (c *Cache[K, V]) Extend(key K, duration time.Duration) bool {
+	key = c.normalizeKey(key)
 	item := c.getShard(key).get(key)
-	if item == nil {
+	if item == nil || item.missing {
 		return false
 	}
-	item.Extend(duration)
+	item.Extend(c.clampTTL(duration))
 	return true
 }
 
-func (c *Cache[T]) Clear() {
-	for _, s := range c.shards {
-		s.clear()
+// SetDeadline makes the item for the key expire at t, or never for the zero time, and reports
+// whether the key was found. Unlike Extend, the expiration is the given instant rather than
+// a duration from now, such as the expiry of a token. A configured MaxTTL still caps it.
+func (c *Cache[K, V]) SetDeadline(key K, t time.Time) bool {
+	key = c.normalizeKey(key)
+	item := c.getShard(key).get(key)
+	if item == nil || item.missing {
+		return false
+	}
+	if c.maxTTL > 0 {
+		if limit := time.Unix(0, now(c.clock)).Add(c.maxTTL); t.IsZero() || t.After(limit) {
+			t = limit
+		}
+	}
+	item.SetDeadline(t)
+	return true
+}
+
+// Touch resets the expiration of a live item to now plus the TTL it was stored with, and reports whether it did.
+// Missing and expired keys, tombstones, and items stored without a TTL, are left untouched.
+// Unlike TouchMany, it does not move the item in the eviction order.
+func (c *Cache[K, V]) Touch(key K) bool {
+	key = c.normalizeKey(key)
+	item := c.getShard(key).get(key)
+	if item == nil || item.Expired() || item.missing || item.ttl <= 0 {
+		return false
 	}
+	item.slide()
+	return true
 }
 
-func (c *Cache[T]) Range(fn func(key string, value T) bool) {
-	for _, shard := range c.shards {
-		if !shard.forEach(fn) {
+// Clear removes every item from the cache. It pauses the workers, so when it returns
+// the items are out of the eviction policy and Size is back to 0, except for items stored concurrently.
+// The removed items go through the OnEvict callback.
+func (c *Cache[K, V]) Clear() {
+	c.do(func() {
+		c.clear(Cleared)
+	})
+}
+
+// clear empties every shard, releasing the items for the given reason. The workers must be paused.
+func (c *Cache[K, V]) clear(reason EvictReason) {
+	for i, s := range c.shards {
+		w := c.workers[i%len(c.workers)]
+		for _, item := range s.clear() {
+			w.doDelete(deletion[K, V]{item: item, notify: true, reason: reason})
+		}
+	}
+}
+
+// Range calls fn for every item of the cache, until fn returns false. It visits everything the shards hold,
+// including expired items that were not removed yet and the tombstones stored by SetMissing; use RangeLive
+// to only visit the items Get would return as live. Every shard is copied under its read lock before fn is
+// first called, so Range is safe to use while other goroutines write to the cache, and fn may itself call the cache,
+// including to start another scan: fn does not count against MaxConcurrentScans.
+func (c *Cache[K, V]) Range(fn func(key K, value V) bool) {
+	c.scan(false, fn)
+}
+
+// RangeLive calls fn for every item of the cache that has not expired, until fn returns false,
+// leaving out the tombstones stored by SetMissing. Items are checked when their shard is copied,
+// so an item may expire by the time fn is called for it. It is otherwise like Range.
+func (c *Cache[K, V]) RangeLive(fn func(key K, value V) bool) {
+	c.scan(true, fn)
+}
+
+// RangeItems calls fn for every item of the cache, including expired items but not the tombstones
+// stored by SetMissing, until fn returns false. The items are not promoted. Each shard is walked
+// under its read lock, so fn must not modify the item nor call back into the cache.
+func (c *Cache[K, V]) RangeItems(fn func(item *Item[K, V]) bool) {
+	c.acquireScan()
+	defer c.releaseScan()
+	for _, s := range c.shards {
+		more := s.forEachItem(func(item *Item[K, V]) bool {
+			return item.missing || fn(item)
+		})
+		if !more {
 			return
 		}
 	}
 }
 
-func (s *shard[T]) forEach(fn func(key string, value T) bool) bool {
+// RangeParallel calls fn for every item of the cache, including expired items but not the tombstones
+// stored by SetMissing, spreading the shards over the given number of goroutines, GOMAXPROCS if it is not positive.
+// It returns once every item has been visited. Each goroutine holds the read lock of the shard it is walking
+// while calling fn, so fn must be safe for concurrent use and must not call back into the cache.
+func (c *Cache[K, V]) RangeParallel(workers int, fn func(key K, value V)) {
+	if workers <= 0 {
+		workers = runtime.GOMAXPROCS(0)
+	}
+	workers = min(workers, len(c.shards))
+	c.acquireScan()
+	defer c.releaseScan()
+
+	var next atomic.Int64
+	var wg sync.WaitGroup
+	for range workers {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := next.Add(1) - 1; i < int64(len(c.shards)); i = next.Add(1) - 1 {
+				c.shards[i].forEachItem(func(item *Item[K, V]) bool {
+					if !item.missing {
+						fn(item.key, item.value)
+					}
+					return true
+				})
+			}
+		}()
+	}
+	wg.Wait()
+}
+
+// scan walks every shard, or only its live items, bounded by the configured number of concurrent scans.
+// Only the copy of the shards counts as a scan: the slot is released before fn is called,
+// so that fn may start another scan even when a single one is allowed.
+func (c *Cache[K, V]) scan(live bool, fn func(key K, value V) bool) {
+	c.acquireScan()
+	shards := make([][]Entry[K, V], len(c.shards))
+	for i, s := range c.shards {
+		shards[i] = s.entries(live)
+	}
+	c.releaseScan()
+	for _, entries := range shards {
+		for _, entry := range entries {
+			if !fn(entry.Key, entry.Value) {
+				return
+			}
+		}
+	}
+}
+
+// acquireScan waits until a full scan is allowed to start, and releaseScan ends it.
+func (c *Cache[K, V]) acquireScan() {
+	if c.scans != nil {
+		c.scans <- struct{}{}
+	}
+}
+
+func (c *Cache[K, V]) releaseScan() {
+	if c.scans != nil {
+		<-c.scans
+	}
+}
+
+// entries copies the keys and values of the shard, or only of its live items, under the read lock.
+func (s *shard[K, V]) entries(live bool) []Entry[K, V] {
+	s.RLock()
+	defer s.RUnlock()
+	entries := make([]Entry[K, V], 0, len(s.store))
 	for _, item := range s.store {
-		if !fn(item.key, item.value) {
-			return false
+		if live && (item.missing || item.Expired()) {
+			continue
 		}
+		entries = append(entries, Entry[K, V]{Key: item.key, Value: item.value})
 	}
-	return true
+	return entries
+}
+
+// RangePrefix calls fn for every item whose key starts with prefix, until fn returns false.
+// Keys that are not strings are matched in their fmt.Sprint form.
+func (c *Cache[K, V]) RangePrefix(prefix string, fn func(key K, value V) bool) {
+	c.scan(false, func(key K, value V) bool {
+		if !strings.HasPrefix(keyString(key), prefix) {
+			return true
+		}
+		return fn(key, value)
+	})
+}
+
+// DeletePrefix removes every item whose key starts with prefix and returns how many were removed.
+// The removed items go through the OnEvict callback like with Delete.
+func (c *Cache[K, V]) DeletePrefix(prefix string) int {
+	removed := 0
+	for _, s := range c.shards {
+		for _, item := range s.deleteFunc(func(item *Item[K, V]) bool {
+			return strings.HasPrefix(keyString(item.key), prefix)
+		}) {
+			c.discard(deletion[K, V]{item: item, notify: true, reason: Deleted})
+			removed++
+		}
+	}
+	return removed
 }
 
-func (c *Cache[T]) Filter(pattern string) []*Item[T] {
-	var result []*Item[T]
-	c.Range(func(key string, value T) bool {
-		if strings.Contains(key, pattern) {
-			item := c.Get(key)
-			if item != nil {
+// Filter returns the items whose key contains pattern, without promoting them.
+// Keys that are not strings are matched in their fmt.Sprint form.
+func (c *Cache[K, V]) Filter(pattern string) []*Item[K, V] {
+	return c.FilterFunc(func(key K) bool {
+		return strings.Contains(keyString(key), pattern)
+	})
+}
+
+// FilterFunc returns the items whose key matches, including expired items but not the tombstones
+// stored by SetMissing, without promoting them.
+// The items are collected during a single walk of the shards, each read under its lock:
+// match is called while the read lock is held, so it must not call back into the cache.
+func (c *Cache[K, V]) FilterFunc(match func(key K) bool) []*Item[K, V] {
+	c.acquireScan()
+	defer c.releaseScan()
+
+	var result []*Item[K, V]
+	for _, s := range c.shards {
+		s.forEachItem(func(item *Item[K, V]) bool {
+			if !item.missing && match(item.key) {
 				result = append(result, item)
 			}
+			return true
+		})
+	}
+	return result
+}
+
+// Keys returns the keys of every item in the cache, including expired items but not the tombstones
+// stored by SetMissing, without copying values.
+// The result is a snapshot taken one shard at a time and may be stale as soon as it is returned.
+func (c *Cache[K, V]) Keys() []K {
+	c.acquireScan()
+	defer c.releaseScan()
+
+	keys := make([]K, 0, c.ItemCount())
+	for _, s := range c.shards {
+		s.forEachItem(func(item *Item[K, V]) bool {
+			if !item.missing {
+				keys = append(keys, item.key)
+			}
+			return true
+		})
+	}
+	return keys
+}
+
+// TopBy returns the first n items of the cache in the order defined by less, sorted in that order,
+// leaving out the tombstones stored by SetMissing.
+// Only n items are kept in memory while the shards are walked under their read locks,
+// so less must not call back into the cache.
+func (c *Cache[K, V]) TopBy(n int, less func(a, b *Item[K, V]) bool) []*Item[K, V] {
+	if n <= 0 {
+		return nil
+	}
+	c.acquireScan()
+	defer c.releaseScan()
+
+	top := &itemHeap[K, V]{less: less}
+	for _, s := range c.shards {
+		s.forEachItem(func(item *Item[K, V]) bool {
+			if item.missing {
+				return true
+			}
+			if top.Len() < n {
+				heap.Push(top, item)
+			} else if less(item, top.items[0]) {
+				top.items[0] = item
+				heap.Fix(top, 0)
+			}
+			return true
+		})
+	}
+
+	result := top.items
+	slices.SortFunc(result, func(a, b *Item[K, V]) int {
+		switch {
+		case less(a, b):
+			return -1
+		case less(b, a):
+			return 1
+		default:
+			return 0
 		}
-		return true
 	})
 	return result
 }
 
-func (c *Cache[T]) doPromote(item *Item[T]) bool {
-	if item.promotions < 0 {
-		return false
+// evicted invokes the OnEvict callback, if any, for an item leaving the cache for the given reason,
+// and the item's own expire callback if it expired. Tombstones hold no value and are not reported.
+func (c *Cache[K, V]) evicted(item *Item[K, V], reason EvictReason) {
+	if item.missing {
+		return
 	}
+	if reason == Expired && item.onExpire != nil {
+		item.onExpire(item.key, item.value)
+	}
+	if c.onEvict != nil {
+		c.onEvict(item.key, item.value, reason)
+	}
+}
 
-	if item.node != nil {
-		if item.shouldPromote(int32(c.getsPerPromote)) {
-			c.queue.moveToFront(item.node)
-			item.promotions = 0
-		}
-		return false
+// replaceNotifies reports whether replacing the old item with value should invoke the OnEvict callback,
+// which is only the case when the value actually changes and the old item is not a tombstone.
+func (c *Cache[K, V]) replaceNotifies(old *Item[K, V], value V) bool {
+	return c.onEvict != nil && !old.missing && !reflect.DeepEqual(old.value, value)
+}
+
+// workerOf returns the worker owning the shard of the key.
+func (c *Cache[K, V]) workerOf(key K) *worker[K, V] {
+	if len(c.workers) == 1 {
+		return c.workers[0]
 	}
+	return c.workers[c.shardIndex(key)%uint32(len(c.workers))]
+}
 
-	c.size += item.size
-	item.node = c.queue.pushToFront(item)
-	return true
+// discard hands a deletion to the worker of the item without blocking.
+func (c *Cache[K, V]) discard(d deletion[K, V]) {
+	c.workerOf(d.item.key).discard(d)
 }
 
-func (c *Cache[T]) doDelete(item *Item[T]) {
-	if item.node != nil {
-		if c.freeList.len() < c.freeList.cap() {
-			c.freeList.put(item)
-		} else {
-			c.queue.remove(item.node)
-			item.node = nil
-			item.promotions = -1
-		}
+// promote hands a promotion to the worker of the item, waiting for room as configured by PromoteTimeout.
+func (c *Cache[K, V]) promote(p promotion[K, V]) {
+	c.workerOf(p.item.key).promote(p)
+}
 
-		c.size -= item.size
-	} else {
-		item.promotions = -1
-	}
+// tryPromote hands a promotion for an accessed item to its worker without waiting.
+func (c *Cache[K, V]) tryPromote(item *Item[K, V]) {
+	c.workerOf(item.key).tryPromote(item)
 }
 
-func (c *Cache[T]) getShard(key string) *shard[T] {
-	h := fnv.New32a()
-	h.Write([]byte(key))
-	return c.shards[h.Sum32()&c.shardMask]
+// promotion is a request for the worker to start tracking an item, or to record an access to it.
+// force skips the gets-per-promote throttling, moving the item even if it was promoted recently.
+type promotion[K comparable, V any] struct {
+	item  *Item[K, V]
+	force bool
 }
 
-func (c *Cache[T]) worker() {
-	promoteItem := func(item *Item[T]) {
-		if c.doPromote(item) && c.size > c.maxSize {
-			c.gc()
-		}
+// deletion is a request for the worker to stop tracking an item.
+// notify tells whether the OnEvict callback should be invoked for the item, and reason why it left.
+type deletion[K comparable, V any] struct {
+	item   *Item[K, V]
+	notify bool
+	reason EvictReason
+}
+
+func (c *Cache[K, V]) getShard(key K) *shard[K, V] {
+	return c.shards[c.shardIndex(key)]
+}
+
+func (c *Cache[K, V]) shardIndex(key K) uint32 {
+	return c.hash(key) & c.shardMask
+}
+
+const (
+	fnvOffset32 = 2166136261
+	fnvPrime32  = 16777619
+)
+
+// fnv32a computes the FNV-1a hash of the key without allocating,
+// producing the same value as hash/fnv's New32a.
+func fnv32a(key string) uint32 {
+	h := uint32(fnvOffset32)
+	for i := 0; i < len(key); i++ {
+		h ^= uint32(key[i])
+		h *= fnvPrime32
 	}
+	return h
+}
 
-	for {
+// do pauses every worker, runs fn while none of them is using its eviction policy, and resumes them.
+// Calls are serialized, so that two of them cannot each pause some of the workers and wait for the others.
+// Once the cache is closed, the workers are gone and fn is not run.
+func (c *Cache[K, V]) do(fn func()) {
+	c.doMu.Lock()
+	defer c.doMu.Unlock()
+	paused := make(chan struct{}, len(c.workers))
+	resume := make(chan struct{})
+	defer close(resume)
+	for _, w := range c.workers {
 		select {
-		case item := <-c.deletables:
-			c.doDelete(item)
-		case item := <-c.promotables:
-			promoteItem(item)
+		case w.control <- func() {
+			paused <- struct{}{}
+			<-resume
+		}:
+		case <-c.done:
+			return
 		}
 	}
+	for range c.workers {
+		<-paused
+	}
+	fn()
 }
 
-func (c *Cache[T]) gc() {
-	node := c.queue.tail
-	itemsToPrune := c.itemsToPrune
+// queueLen returns the number of items tracked by the eviction policies once the pending
+// promotions and deletions are processed. After Sync, with no concurrent writes, it should match ItemCount;
+// a difference points at items the size accounting lost track of.
+func (c *Cache[K, V]) queueLen() int {
+	n := 0
+	c.do(func() {
+		for _, w := range c.workers {
+			w.drain()
+			n += w.policy.len()
+		}
+	})
+	return n
+}
 
-	if min := c.size - c.maxSize; min > itemsToPrune {
-		itemsToPrune = min
-	}
-	for range itemsToPrune {
-		if node == nil {
-			break
+// Sync blocks until the workers have processed the promotions and deletions queued so far,
+// so that Size and Stats account for every operation that returned before the call.
+// Operations started concurrently or after the call may still be pending when it returns.
+func (c *Cache[K, V]) Sync() {
+	c.do(func() {
+		for _, w := range c.workers {
+			w.drain()
+		}
+	})
+}
+
+// Close stops the worker goroutines and the janitor, if any, waits for the background reloads
+// of StaleWhileRevalidate, and gives the cache's space back to its budget.
+// It first processes the pending promotions and deletions, and returns once every OnEvict callback
+// they trigger has returned, so that the resources released by the callbacks are released before Close returns.
+// It must not be called from an OnEvict callback, which would wait for itself.
+// Writes are rejected with ErrClosed as soon as Close is called; the cache must not be used otherwise after it is closed.
+func (c *Cache[K, V]) Close() {
+	c.closeOnce.Do(func() {
+		c.closing.Store(true)
+		c.do(func() {
+			for _, w := range c.workers {
+				w.drain()
+			}
+		})
+		close(c.done)
+		c.running.Wait()
+		if c.budget != nil {
+			c.budget.unregister(c.budgetMember)
+		}
+	})
+}
+
+// DrainAndClose removes every item, invoking the OnEvict callback with the Shutdown reason for each,
+// and then closes the cache. Writes are rejected with ErrClosed as soon as it is called, and the drain
+// waits for the writes admitted before, so that no item is left behind; the pending operations are processed first.
+func (c *Cache[K, V]) DrainAndClose() {
+	c.closing.Store(true)
+	// Every write holds writes for reading from the admission of its key to the store of its item,
+	// so taking it waits for the writes admitted before closing was set.
+	c.writes.Lock()
+	c.writes.Unlock()
+	c.do(func() {
+		for _, w := range c.workers {
+			w.drain()
+		}
+		c.clear(Shutdown)
+	})
+	c.Close()
+}
+
+// DeleteExpired removes every expired item from the cache and returns how many were removed.
+// Each shard is locked only while its expired items are taken out, so it is safe to call
+// concurrently with other operations, for instance on a memory pressure signal.
+// The removed items count as expirations and go through the OnEvict callback like with the janitor.
+func (c *Cache[K, V]) DeleteExpired() int {
+	removed := 0
+	for _, s := range c.shards {
+		for _, item := range s.deleteExpired() {
+			c.stats.expirations.Add(1)
+			c.discard(deletion[K, V]{item: item, notify: true, reason: Expired})
+			removed++
 		}
+	}
+	return removed
+}
 
-		prev := node.prev
-		item := node.value
-		if c.freeList.len() < c.freeList.cap() {
-			c.freeList.put(item)
-			c.getShard(item.key).delete(item.key)
-			c.size -= item.size
-		} else {
-			c.getShard(item.key).delete(item.key)
-			c.size -= item.size
-			c.queue.remove(node)
-			item.node = nil
-			item.promotions = -1
+// watchPressure trims the cache to the fullness received on ch, until ch or the cache is closed.
+func (c *Cache[K, V]) watchPressure(ch <-chan float64) {
+	defer c.running.Done()
+	for {
+		select {
+		case fullness, ok := <-ch:
+			if !ok {
+				return
+			}
+			fullness = min(max(fullness, 0), 1)
+			c.TrimToSize(int(fullness * float64(c.MaxSizeValue())))
+		case <-c.done:
+			return
 		}
-		node = prev
 	}
 }
+
+// TrimToSize evicts items chosen by the eviction policy until the size of the cache is at most target,
+// and returns how many were evicted. The items are counted and go through the OnEvict callback
+// like items pruned when the cache grows over its max size. Items still waiting to be tracked
+// by a worker are not counted in the size and cannot be evicted.
+// With several workers, their items are evicted in turn.
+func (c *Cache[K, V]) TrimToSize(target int) int {
+	evicted := 0
+	c.do(func() {
+		for c.Size() > target {
+			progress := false
+			for _, w := range c.workers {
+				if c.Size() <= target {
+					return
+				}
+				if item := w.policy.victim(); item != nil {
+					w.evict(item)
+					evicted++
+					progress = true
+				}
+			}
+			if !progress {
+				return
+			}
+		}
+	})
+	return evicted
+}
@@ -1,15 +1,48 @@
 package cache_test
 
 import (
+	"errors"
+	"hash/crc32"
 	"reflect"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
 	"testing"
 	"time"
 
 	"github.com/mcheviron/cache"
 )
 
+// waitFor polls cond until it returns true or a second has passed,
+// giving the cache's worker goroutine time to process pending operations.
+func waitFor(cond func() bool) {
+	for deadline := time.Now().Add(time.Second); !cond() && time.Now().Before(deadline); {
+		time.Sleep(time.Millisecond)
+	}
+}
+
+// fakeClock is a Clock that only moves when advanced.
+type fakeClock struct {
+	mu  sync.Mutex
+	now time.Time
+}
+
+func (c *fakeClock) Now() time.Time {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.now
+}
+
+func (c *fakeClock) Advance(d time.Duration) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.now = c.now.Add(d)
+}
+
 func TestCacheItemCount(t *testing.T) {
-	cache := cache.New[string](cache.NewConfig())
+	cache := cache.New(cache.NewConfig[string, string]())
 
 	cache.Set("key1", "value1", time.Second)
 	cache.Set("key2", "value2", time.Second)
@@ -23,14 +56,14 @@ func TestCacheItemCount(t *testing.T) {
 }
 
 func TestNewCache(t *testing.T) {
-	cache := cache.New[string](cache.NewConfig())
+	cache := cache.New(cache.NewConfig[string, string]())
 
 	if cache == nil {
 		t.Errorf("Expected cache to be not nil")
 	}
 }
 func TestCacheGet(t *testing.T) {
-	cache := cache.New[string](cache.NewConfig())
+	cache := cache.New(cache.NewConfig[string, string]())
 
 	cache.Set("key1", "value1", time.Second)
 
@@ -46,7 +79,7 @@ func TestCacheGet(t *testing.T) {
 }
 
 func TestCacheGetExpiredItem(t *testing.T) {
-	cache := cache.New[string](cache.NewConfig())
+	cache := cache.New(cache.NewConfig[string, string]())
 
 	cache.Set("key1", "value1", time.Nanosecond)
 
@@ -59,7 +92,7 @@ func TestCacheGetExpiredItem(t *testing.T) {
 	}
 }
 func TestCacheDelete(t *testing.T) {
-	cache := cache.New[string](cache.NewConfig())
+	cache := cache.New(cache.NewConfig[string, string]())
 
 	cache.Set("key1", "value1", time.Second)
 	cache.Set("key2", "value2", time.Second)
@@ -74,8 +107,81 @@ func TestCacheDelete(t *testing.T) {
 	}
 }
 
+func TestCacheGetAndDelete(t *testing.T) {
+	cache := cache.New(cache.NewConfig[string, string]())
+	cache.Set("key1", "value1", time.Minute)
+	cache.Set("key2", "value2", time.Nanosecond)
+	time.Sleep(time.Millisecond)
+
+	if item, ok := cache.GetAndDelete("key1"); !ok || item.Value() != "value1" {
+		t.Errorf("Expected value1 to be returned")
+	}
+	if cache.Peek("key1") != nil {
+		t.Errorf("Expected key1 to be deleted")
+	}
+	if _, ok := cache.GetAndDelete("key2"); ok {
+		t.Errorf("Expected expired item to not be found")
+	}
+	if cache.Peek("key2") != nil {
+		t.Errorf("Expected expired key2 to be deleted")
+	}
+	if _, ok := cache.GetAndDelete("key3"); ok {
+		t.Errorf("Expected missing key to not be found")
+	}
+	cache.SetMissing("key4", time.Minute)
+	if _, ok := cache.GetAndDelete("key4"); ok {
+		t.Errorf("Expected tombstone to not be found")
+	}
+	if cache.GetMissing("key4") {
+		t.Errorf("Expected tombstone of key4 to be deleted")
+	}
+}
+
+func TestCacheGetAndDeleteKeepsItem(t *testing.T) {
+	cache := cache.New(cache.NewConfig[string, string]())
+	cache.Set("job", "payload", time.Minute)
+
+	item, ok := cache.GetAndDelete("job")
+	if !ok {
+		t.Fatalf("Expected job to be found")
+	}
+	cache.Sync()
+	cache.Set("other", "clobbered", time.Minute)
+	cache.Sync()
+
+	if key, value := item.Key(), item.Value(); key != "job" || value != "payload" {
+		t.Errorf("Expected the returned item to still hold job payload, got %s %s", key, value)
+	}
+}
+
+func TestCacheGetAndDeleteIsAtomic(t *testing.T) {
+	cache := cache.New(cache.NewConfig[string, int]())
+
+	for i := range 100 {
+		key := "job" + strconv.Itoa(i)
+		cache.Set(key, i, time.Minute)
+
+		var wins atomic.Int32
+		var wg sync.WaitGroup
+		for range 2 {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				if _, ok := cache.GetAndDelete(key); ok {
+					wins.Add(1)
+				}
+			}()
+		}
+		wg.Wait()
+
+		if n := wins.Load(); n != 1 {
+			t.Fatalf("Expected exactly one consumer to get %s, got %d", key, n)
+		}
+	}
+}
+
 func TestCacheDeleteNonExistingKey(t *testing.T) {
-	cache := cache.New[string](cache.NewConfig())
+	cache := cache.New(cache.NewConfig[string, string]())
 
 	cache.Set("key1", "value1", time.Second)
 	cache.Set("key2", "value2", time.Second)
@@ -89,7 +195,7 @@ func TestCacheDeleteNonExistingKey(t *testing.T) {
 	}
 }
 func TestCacheReplaceExistingItem(t *testing.T) {
-	cache := cache.New[string](cache.NewConfig())
+	cache := cache.New(cache.NewConfig[string, string]())
 
 	cache.Set("key1", "value1", time.Second)
 
@@ -111,7 +217,7 @@ func TestCacheReplaceExistingItem(t *testing.T) {
 }
 
 func TestCacheReplaceNonExistingItem(t *testing.T) {
-	cache := cache.New[string](cache.NewConfig())
+	cache := cache.New(cache.NewConfig[string, string]())
 
 	replaced := cache.Replace("key1", "value1")
 
@@ -125,18 +231,97 @@ func TestCacheReplaceNonExistingItem(t *testing.T) {
 		t.Errorf("Expected item to be nil for non-existing key")
 	}
 }
+func TestCacheReplaceExpiredItem(t *testing.T) {
+	cache := cache.New(cache.NewConfig[string, string]())
+
+	cache.Set("key1", "value1", 50*time.Millisecond)
+	cache.Set("key2", "value2", time.Millisecond)
+	time.Sleep(5 * time.Millisecond)
+
+	if !cache.Replace("key1", "newvalue") {
+		t.Errorf("Expected nearly expired item to be replaced")
+	}
+	if ttl := cache.Peek("key1").TTL(); ttl <= 0 || ttl > 50*time.Millisecond {
+		t.Errorf("Expected replaced item to keep its TTL, got %s", ttl)
+	}
+	if cache.Replace("key2", "newvalue") {
+		t.Errorf("Expected expired item to not be replaced")
+	}
+	if item := cache.Peek("key2"); item.Value() != "value2" {
+		t.Errorf("Expected expired item to keep its value, got '%s'", item.Value())
+	}
+}
+
+func TestCacheReplaceKeepsSizeStable(t *testing.T) {
+	cache := cache.New(cache.NewConfig[string, []byte]().MaxSize(10000).Weigher(func(value []byte) int {
+		return len(value)
+	}))
+
+	cache.Set("key1", make([]byte, 100), time.Minute)
+	for range 100 {
+		if !cache.Replace("key1", make([]byte, 100)) {
+			t.Fatalf("Expected item to be replaced")
+		}
+	}
+	time.Sleep(10 * time.Millisecond)
+
+	if count := cache.ItemCount(); count != 1 {
+		t.Errorf("Expected item count to be 1, got %d", count)
+	}
+	if size := cache.Size(); size != 100 {
+		t.Errorf("Expected size to be 100, got %d", size)
+	}
+}
+
+func TestCacheReplaceRecomputesWeight(t *testing.T) {
+	cache := cache.New(cache.NewConfig[string, []byte]().MaxSize(10000).Weigher(func(value []byte) int {
+		return len(value)
+	}))
+
+	cache.Set("key1", make([]byte, 10), time.Minute)
+	time.Sleep(10 * time.Millisecond)
+	cache.Replace("key1", make([]byte, 1000))
+	time.Sleep(10 * time.Millisecond)
+
+	if size := cache.Size(); size != 1000 {
+		t.Errorf("Expected size to be 1000, got %d", size)
+	}
+	if size := cache.Peek("key1").Size(); size != 1000 {
+		t.Errorf("Expected item size to be 1000, got %d", size)
+	}
+}
+
+func TestCacheEvictedItemKeepsValue(t *testing.T) {
+	cache := cache.New(cache.NewConfig[string, int]().ByCount().MaxSize(10).ItemsToPrune(1))
+
+	cache.Set("key0", 0, time.Minute)
+	held := cache.Get("key0")
+	for i := 1; i < 20; i++ {
+		cache.Set("key"+strconv.Itoa(i), i, time.Minute)
+	}
+	cache.Sync()
+	for i := 20; i < 40; i++ {
+		cache.Set("key"+strconv.Itoa(i), i, time.Minute)
+	}
+	cache.Sync()
+
+	if key, value := held.Key(), held.Value(); key != "key0" || value != 0 {
+		t.Errorf("Expected the evicted item to still hold key0 0, got %s %d", key, value)
+	}
+}
+
 func TestCacheExtendExistingItem(t *testing.T) {
-	cache := cache.New[string](cache.NewConfig())
+	cache := cache.New(cache.NewConfig[string, string]())
 
 	cache.Set("key1", "value1", time.Second)
 
 	start := time.Now()
 	extended := cache.Extend("key1", time.Minute)
-	
+
 	if !extended {
 		t.Errorf("Expected item to be extended")
 	}
-	
+
 	item := cache.Get("key1")
 	elapsed := time.Since(start)
 	if item.TTL() < time.Minute-elapsed {
@@ -145,7 +330,7 @@ func TestCacheExtendExistingItem(t *testing.T) {
 }
 
 func TestCacheExtendNonExistingItem(t *testing.T) {
-	cache := cache.New[string](cache.NewConfig())
+	cache := cache.New(cache.NewConfig[string, string]())
 
 	extended := cache.Extend("key1", time.Minute)
 
@@ -153,8 +338,32 @@ func TestCacheExtendNonExistingItem(t *testing.T) {
 		t.Errorf("Expected item to not be extended")
 	}
 }
+func TestCacheTouch(t *testing.T) {
+	cache := cache.New(cache.NewConfig[string, string]())
+	cache.Set("key1", "value1", 50*time.Millisecond)
+	cache.Set("key2", "value2", 0)
+	cache.Set("key3", "value3", time.Nanosecond)
+	time.Sleep(30 * time.Millisecond)
+
+	if !cache.Touch("key1") {
+		t.Errorf("Expected live item to be touched")
+	}
+	if ttl := cache.Peek("key1").TTL(); ttl < 40*time.Millisecond {
+		t.Errorf("Expected TTL to be reset to about 50ms, got %s", ttl)
+	}
+	if cache.Touch("key2") {
+		t.Errorf("Expected item without TTL to not be touched")
+	}
+	if cache.Touch("key3") {
+		t.Errorf("Expected expired item to not be touched")
+	}
+	if cache.Touch("key4") {
+		t.Errorf("Expected missing key to not be touched")
+	}
+}
+
 func TestCacheClear(t *testing.T) {
-	cache := cache.New[string](cache.NewConfig())
+	cache := cache.New(cache.NewConfig[string, string]())
 
 	cache.Set("key1", "value1", time.Second)
 	cache.Set("key2", "value2", time.Second)
@@ -168,8 +377,324 @@ func TestCacheClear(t *testing.T) {
 		t.Errorf("Expected item count to be 0 after clearing cache, got %d", count)
 	}
 }
+func TestCacheClearResetsSize(t *testing.T) {
+	c := cache.New(cache.NewConfig[string, int]().MaxSize(100).ItemsToPrune(1).Weigher(func(int) int { return 1 }))
+
+	for i := range 95 {
+		c.Set("key"+strconv.Itoa(i), i, time.Minute)
+	}
+	time.Sleep(10 * time.Millisecond)
+
+	c.Clear()
+	if size := c.Size(); size != 0 {
+		t.Errorf("Expected size to be 0 after clearing, got %d", size)
+	}
+
+	for i := range 95 {
+		c.Set("new"+strconv.Itoa(i), i, time.Minute)
+	}
+	time.Sleep(10 * time.Millisecond)
+
+	if evictions := c.Stats().Evictions; evictions != 0 {
+		t.Errorf("Expected no eviction after clearing, got %d", evictions)
+	}
+	if count := c.ItemCount(); count != 95 {
+		t.Errorf("Expected item count to be 95, got %d", count)
+	}
+}
+
+func TestCacheCloseWaitsForOnEvict(t *testing.T) {
+	var finished atomic.Bool
+	c := cache.New(cache.NewConfig[string, int]().OnEvict(func(string, int, cache.EvictReason) {
+		time.Sleep(50 * time.Millisecond)
+		finished.Store(true)
+	}))
+
+	c.Set("key1", 1, time.Minute)
+	c.Delete("key1")
+	c.Close()
+
+	if !finished.Load() {
+		t.Errorf("Expected Close to wait for the OnEvict callback to finish")
+	}
+}
+
+func TestCacheWriteAfterClose(t *testing.T) {
+	c := cache.New(cache.NewConfig[string, int]().PromoteBuffer(1))
+	c.Set("key1", 1, time.Minute)
+	c.Close()
+
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		for i := range 10 {
+			c.Set("set"+strconv.Itoa(i), i, time.Minute)
+			if err := c.SetWithResult("result"+strconv.Itoa(i), i, time.Minute); !errors.Is(err, cache.ErrClosed) {
+				t.Errorf("Expected ErrClosed for a write after Close, got %v", err)
+			}
+		}
+	}()
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Fatalf("Expected writes after Close to not block")
+	}
+	if c.Peek("set0") != nil {
+		t.Errorf("Expected Set after Close to not store the value")
+	}
+}
+
+func TestCacheDrainAndClose(t *testing.T) {
+	var mu sync.Mutex
+	reasons := make(map[string]cache.EvictReason)
+	c := cache.New(cache.NewConfig[string, int]().OnEvict(func(key string, _ int, reason cache.EvictReason) {
+		mu.Lock()
+		reasons[key] = reason
+		mu.Unlock()
+	}))
+
+	for i := range 10 {
+		c.Set("key"+strconv.Itoa(i), i, time.Minute)
+	}
+
+	c.DrainAndClose()
+
+	if err := c.SetWithResult("late", 1, time.Minute); !errors.Is(err, cache.ErrClosed) {
+		t.Errorf("Expected ErrClosed for a write after DrainAndClose, got %v", err)
+	}
+
+	mu.Lock()
+	defer mu.Unlock()
+	if len(reasons) != 10 {
+		t.Fatalf("Expected OnEvict to be called for the 10 items, got %d", len(reasons))
+	}
+	for key, reason := range reasons {
+		if reason != cache.Shutdown {
+			t.Errorf("Expected %s to be evicted with reason Shutdown, got %v", key, reason)
+		}
+	}
+	if count := c.ItemCount(); count != 0 {
+		t.Errorf("Expected item count to be 0, got %d", count)
+	}
+}
+
+func TestCacheDrainAndCloseConcurrentWrites(t *testing.T) {
+	var shutdowns atomic.Int64
+	// The slow weigher widens the window between the admission of a write and the store of its item.
+	c := cache.New(cache.NewConfig[string, int]().MaxSize(1 << 20).
+		Weigher(func(int) int {
+			time.Sleep(time.Millisecond)
+			return 1
+		}).
+		OnEvict(func(_ string, _ int, reason cache.EvictReason) {
+			if reason == cache.Shutdown {
+				shutdowns.Add(1)
+			}
+		}))
+
+	var stored atomic.Int64
+	var wg sync.WaitGroup
+	for w := range 8 {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := 0; ; i++ {
+				err := c.SetWithResult(strconv.Itoa(w)+":"+strconv.Itoa(i), i, time.Minute)
+				if errors.Is(err, cache.ErrClosed) {
+					return
+				}
+				stored.Add(1)
+			}
+		}()
+	}
+	time.Sleep(10 * time.Millisecond)
+	c.DrainAndClose()
+	wg.Wait()
+
+	if n, expected := shutdowns.Load(), stored.Load(); n != expected {
+		t.Errorf("Expected every stored item to be evicted with reason Shutdown, got %d of %d", n, expected)
+	}
+	if count := c.ItemCount(); count != 0 {
+		t.Errorf("Expected item count to be 0, got %d", count)
+	}
+}
+
+func TestCacheSetWithSize(t *testing.T) {
+	var weighed atomic.Int32
+	c := cache.New(cache.NewConfig[string, string]().MaxSize(100).MaxItemSize(50).Weigher(func(value string) int {
+		weighed.Add(1)
+		return len(value)
+	}))
+
+	if err := c.SetWithSize("key1", "value1", time.Minute, 42); err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	if item := c.Get("key1"); item == nil || item.Size() != 42 {
+		t.Errorf("Expected the item to weigh the given size")
+	}
+	if n := weighed.Load(); n != 0 {
+		t.Errorf("Expected the weigher to not be called, got %d calls", n)
+	}
+
+	if err := c.SetWithSize("key2", "value2", time.Minute, -1); !errors.Is(err, cache.ErrInvalidWeight) {
+		t.Errorf("Expected ErrInvalidWeight for a negative size, got %v", err)
+	}
+	if err := c.SetWithSize("key2", "value2", time.Minute, 51); !errors.Is(err, cache.ErrItemTooLarge) {
+		t.Errorf("Expected ErrItemTooLarge for a size over the max item size, got %v", err)
+	}
+	if c.Has("key2") {
+		t.Errorf("Expected rejected values to not be stored")
+	}
+
+	time.Sleep(10 * time.Millisecond)
+	if size := c.Size(); size != 42 {
+		t.Errorf("Expected size to be 42, got %d", size)
+	}
+}
+
+func TestCacheSetWithSizeByCount(t *testing.T) {
+	c := cache.New(cache.NewConfig[string, string]().ByCount().MaxSize(10))
+
+	for i := range 5 {
+		if err := c.SetWithSize("key"+strconv.Itoa(i), "value", time.Minute, 1000); err != nil {
+			t.Fatalf("Expected no error, got %v", err)
+		}
+	}
+	c.Sync()
+
+	if item := c.Get("key0"); item == nil || item.Size() != 1 {
+		t.Errorf("Expected the item to count as 1")
+	}
+	if size := c.Size(); size != 5 {
+		t.Errorf("Expected size to be the item count 5, got %d", size)
+	}
+}
+
+func TestCacheValueCopy(t *testing.T) {
+	c := cache.New(cache.NewConfig[string, []int]().Copier(slices.Clone[[]int]))
+	c.Set("key1", []int{1, 2, 3}, time.Minute)
+
+	value := c.Get("key1").ValueCopy()
+	value[0] = 42
+
+	if cached := c.Get("key1").Value(); cached[0] != 1 {
+		t.Errorf("Expected the cached value to be unchanged, got %v", cached)
+	}
+
+	shared := cache.New(cache.NewConfig[string, []int]())
+	shared.Set("key1", []int{1, 2, 3}, time.Minute)
+
+	shared.Get("key1").ValueCopy()[0] = 42
+
+	if cached := shared.Get("key1").Value(); cached[0] != 42 {
+		t.Errorf("Expected ValueCopy to return the value itself without a copier, got %v", cached)
+	}
+}
+
+func TestCacheClock(t *testing.T) {
+	clock := &fakeClock{now: time.Unix(1000, 0)}
+	c := cache.New(cache.NewConfig[string, string]().Clock(clock))
+
+	c.Set("key1", "value1", time.Minute)
+	c.SetWithSoftTTL("key2", "value2", time.Second, time.Hour)
+
+	if ttl := c.Peek("key1").TTL(); ttl != time.Minute {
+		t.Errorf("Expected TTL to be exactly 1 minute on a stopped clock, got %s", ttl)
+	}
+
+	clock.Advance(2 * time.Second)
+
+	if !c.Peek("key2").Stale() {
+		t.Errorf("Expected item to be stale once the clock passed its soft TTL")
+	}
+	if item := c.Get("key1"); item == nil || item.TTL() != time.Minute-2*time.Second {
+		t.Errorf("Expected item to still be live with 58s left")
+	}
+	if accessed := c.Peek("key1").LastAccess(); !accessed.Equal(clock.Now()) {
+		t.Errorf("Expected last access to be read from the clock, got %s", accessed)
+	}
+
+	clock.Advance(time.Minute)
+
+	if c.Has("key1") || !c.Peek("key1").Expired() {
+		t.Errorf("Expected item to be expired once the clock passed its TTL")
+	}
+	if c.Extend("key2", time.Minute); c.Peek("key2").TTL() != time.Minute {
+		t.Errorf("Expected Extend to use the clock")
+	}
+}
+
+func TestCacheMaxTTL(t *testing.T) {
+	clock := &fakeClock{now: time.Unix(1000, 0)}
+	c := cache.New(cache.NewConfig[string, string]().Clock(clock).MaxTTL(time.Hour))
+
+	c.Set("key1", "value1", 10*time.Hour)
+	if ttl := c.Peek("key1").TTL(); ttl != time.Hour {
+		t.Errorf("Expected TTL to be capped to 1 hour, got %s", ttl)
+	}
+
+	c.Set("key2", "value2", 0)
+	if ttl := c.Peek("key2").TTL(); ttl != time.Hour {
+		t.Errorf("Expected an item that never expires to be capped to 1 hour, got %s", ttl)
+	}
+
+	c.Set("key3", "value3", time.Minute)
+	c.Extend("key3", 24*time.Hour)
+	if ttl := c.Peek("key3").TTL(); ttl != time.Hour {
+		t.Errorf("Expected Extend to be capped to 1 hour, got %s", ttl)
+	}
+
+	clock.Advance(time.Minute)
+	c.Replace("key1", "new value")
+	if ttl := c.Peek("key1").TTL(); ttl != time.Hour-time.Minute {
+		t.Errorf("Expected Replace to keep the capped expiration, got %s", ttl)
+	}
+}
+
+func TestCacheMinTTL(t *testing.T) {
+	clock := &fakeClock{now: time.Unix(1000, 0)}
+	c := cache.New(cache.NewConfig[string, string]().Clock(clock).MinTTL(time.Second))
+
+	c.Set("key1", "value1", time.Nanosecond)
+	if ttl := c.Peek("key1").TTL(); ttl != time.Second {
+		t.Errorf("Expected TTL to be raised to 1 second, got %s", ttl)
+	}
+
+	c.Set("key2", "value2", 0)
+	if ttl := c.Peek("key2").TTL(); ttl != cache.NoExpiration {
+		t.Errorf("Expected a zero TTL to still never expire, got %s", ttl)
+	}
+
+	c.Set("key3", "value3", time.Minute)
+	if ttl := c.Peek("key3").TTL(); ttl != time.Minute {
+		t.Errorf("Expected a TTL over the minimum to be kept, got %s", ttl)
+	}
+}
+
+func TestCacheSetDeadline(t *testing.T) {
+	clock := &fakeClock{now: time.Unix(1000, 0)}
+	c := cache.New(cache.NewConfig[string, string]().Clock(clock))
+	c.Set("key1", "value1", time.Minute)
+
+	if !c.SetDeadline("key1", clock.Now().Add(2*time.Second)) {
+		t.Fatalf("Expected the deadline of an existing key to be set")
+	}
+	if ttl := c.Peek("key1").TTL(); ttl != 2*time.Second {
+		t.Errorf("Expected TTL to be 2s, got %s", ttl)
+	}
+
+	clock.Advance(3 * time.Second)
+	if !c.Peek("key1").Expired() {
+		t.Errorf("Expected item to be expired past its deadline")
+	}
+
+	if c.SetDeadline("key2", clock.Now().Add(time.Minute)) {
+		t.Errorf("Expected SetDeadline to report false for a missing key")
+	}
+}
+
 func TestForEach(t *testing.T) {
-	cache := cache.New[string](cache.NewConfig())
+	cache := cache.New(cache.NewConfig[string, string]())
 
 	cache.Set("key1", "value1", time.Second)
 	cache.Set("key2", "value2", time.Second)
@@ -197,8 +722,165 @@ func TestForEach(t *testing.T) {
 		t.Errorf("Expected values to be %v, got %v", expectedValues, values)
 	}
 }
+
+func TestCacheRangeConcurrentSet(t *testing.T) {
+	c := cache.New(cache.NewConfig[string, int]().Shards(1))
+	for i := range 100 {
+		c.Set("key"+strconv.Itoa(i), i, time.Minute)
+	}
+
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		for i := range 1000 {
+			c.Set("new"+strconv.Itoa(i), i, time.Minute)
+		}
+	}()
+
+	for {
+		select {
+		case <-done:
+			return
+		default:
+		}
+		c.Range(func(key string, value int) bool {
+			return true
+		})
+	}
+}
+func TestCacheRangeCallsBack(t *testing.T) {
+	c := cache.New(cache.NewConfig[string, int]().Shards(1))
+	for i := range 10 {
+		c.Set("key"+strconv.Itoa(i), i, time.Minute)
+	}
+
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		c.Range(func(key string, value int) bool {
+			c.Delete(key)
+			c.Set("copy:"+key, value, time.Minute)
+			return true
+		})
+	}()
+
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Fatal("Expected Range to allow fn to write to the cache")
+	}
+	if c.Has("key0") || !c.Has("copy:key0") {
+		t.Errorf("Expected the writes made by fn to be applied")
+	}
+}
+
+func TestCacheFilterConcurrentDelete(t *testing.T) {
+	c := cache.New(cache.NewConfig[string, int]().Shards(1))
+	for i := range 1000 {
+		c.Set("key"+strconv.Itoa(i), i, time.Minute)
+	}
+
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		for i := range 1000 {
+			c.Delete("key" + strconv.Itoa(i))
+		}
+	}()
+
+	for {
+		select {
+		case <-done:
+			return
+		default:
+		}
+		c.Filter("key")
+	}
+}
+
+func TestCacheRangeItems(t *testing.T) {
+	c := cache.New(cache.NewConfig[string, string]().Weigher(func(value string) int { return len(value) }))
+
+	c.Set("small", "a", time.Minute)
+	c.Set("large", "abcdefghij", time.Minute)
+	c.SetMissing("gone", time.Minute)
+
+	sizes := make(map[string]int)
+	c.RangeItems(func(item *cache.Item[string, string]) bool {
+		sizes[item.Key()] = item.Size()
+		return true
+	})
+
+	if expected := map[string]int{"small": 1, "large": 10}; !reflect.DeepEqual(sizes, expected) {
+		t.Errorf("Expected sizes %v, got %v", expected, sizes)
+	}
+
+	visited := 0
+	c.RangeItems(func(item *cache.Item[string, string]) bool {
+		visited++
+		return false
+	})
+	if visited != 1 {
+		t.Errorf("Expected RangeItems to stop when fn returns false, visited %d items", visited)
+	}
+	if hits := c.Stats().Hits; hits != 0 {
+		t.Errorf("Expected RangeItems to not count as gets, got %d hits", hits)
+	}
+}
+
+func TestCacheRangeParallel(t *testing.T) {
+	c := cache.New(cache.NewConfig[string, int]().ByCount().MaxSize(2000))
+	for i := range 1000 {
+		c.Set("key"+strconv.Itoa(i), i, time.Minute)
+	}
+	c.SetMissing("gone", time.Minute)
+
+	var mu sync.Mutex
+	seen := make(map[string]int)
+	c.RangeParallel(4, func(key string, value int) {
+		mu.Lock()
+		seen[key] = value
+		mu.Unlock()
+	})
+
+	if len(seen) != 1000 {
+		t.Errorf("Expected every item but the tombstone to be visited once, got %d", len(seen))
+	}
+	if seen["key42"] != 42 {
+		t.Errorf("Expected key42 to hold 42, got %d", seen["key42"])
+	}
+}
+
+func TestCacheRangeLive(t *testing.T) {
+	clock := &fakeClock{now: time.Unix(1000, 0)}
+	c := cache.New(cache.NewConfig[string, string]().Clock(clock))
+
+	c.Set("live", "value1", time.Minute)
+	c.Set("expired", "value2", time.Second)
+	c.SetMissing("gone", time.Minute)
+	clock.Advance(2 * time.Second)
+
+	var live, all []string
+	c.RangeLive(func(key string, value string) bool {
+		live = append(live, key)
+		return true
+	})
+	c.Range(func(key string, value string) bool {
+		all = append(all, key)
+		return true
+	})
+	slices.Sort(all)
+
+	if expected := []string{"live"}; !slices.Equal(live, expected) {
+		t.Errorf("Expected RangeLive to visit %v, got %v", expected, live)
+	}
+	if expected := []string{"expired", "gone", "live"}; !slices.Equal(all, expected) {
+		t.Errorf("Expected Range to visit %v, got %v", expected, all)
+	}
+}
+
 func TestCacheFilter(t *testing.T) {
-	cache := cache.New[string](cache.NewConfig())
+	cache := cache.New(cache.NewConfig[string, string]())
 
 	cache.Set("key1", "value1", time.Second)
 	cache.Set("key2", "value2", time.Second)
@@ -224,7 +906,7 @@ func TestCacheFilter(t *testing.T) {
 	}
 }
 func TestCacheFilterEmptyResult(t *testing.T) {
-	cache := cache.New[string](cache.NewConfig())
+	cache := cache.New(cache.NewConfig[string, string]())
 
 	cache.Set("key1", "value1", time.Second)
 	cache.Set("key2", "value2", time.Second)
@@ -236,3 +918,1643 @@ func TestCacheFilterEmptyResult(t *testing.T) {
 		t.Errorf("Expected filtered items count to be 0, got %d", len(filtered))
 	}
 }
+
+func TestCachePeek(t *testing.T) {
+	cache := cache.New(cache.NewConfig[string, string]())
+
+	cache.Set("key1", "value1", time.Second)
+
+	item := cache.Peek("key1")
+
+	if item == nil {
+		t.Fatalf("Expected item to be not nil")
+	}
+
+	if item.Value() != "value1" {
+		t.Errorf("Expected item value to be 'value1', got '%s'", item.Value())
+	}
+
+	if cache.Peek("key2") != nil {
+		t.Errorf("Expected item to be nil for non-existing key")
+	}
+}
+
+func TestCachePeekDoesNotPromote(t *testing.T) {
+	cache := cache.New(cache.NewConfig[string, int]().ByCount().MaxSize(3).ItemsToPrune(1).GetsPerPromote(1))
+
+	cache.Set("a", 1, time.Minute)
+	cache.Set("b", 2, time.Minute)
+	cache.Set("c", 3, time.Minute)
+	cache.Sync()
+
+	if item := cache.Peek("a"); item == nil {
+		t.Fatalf("Expected to peek a")
+	}
+	cache.Sync()
+	cache.Set("d", 4, time.Minute)
+	cache.Sync()
+
+	if cache.Peek("a") != nil {
+		t.Errorf("Expected the peeked item to be evicted first")
+	}
+	if cache.Peek("b") == nil {
+		t.Errorf("Expected b to survive the eviction")
+	}
+}
+
+func TestCacheWeigher(t *testing.T) {
+	config := cache.NewConfig[string, []byte]().Weigher(func(value []byte) int {
+		return len(value)
+	})
+	cache := cache.New(config)
+
+	cache.Set("key1", make([]byte, 1000), time.Second)
+
+	item := cache.Get("key1")
+
+	if item == nil {
+		t.Fatalf("Expected item to be not nil")
+	}
+
+	if item.Size() != 1000 {
+		t.Errorf("Expected item size to be 1000, got %d", item.Size())
+	}
+}
+
+func TestCacheMaxConcurrentScans(t *testing.T) {
+	cache := cache.New(cache.NewConfig[string, string]().MaxConcurrentScans(2))
+
+	cache.Set("key1", "value1", time.Second)
+
+	var running, peak atomic.Int32
+	var wg sync.WaitGroup
+	for range 10 {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			cache.FilterFunc(func(key string) bool {
+				n := running.Add(1)
+				for {
+					p := peak.Load()
+					if n <= p || peak.CompareAndSwap(p, n) {
+						break
+					}
+				}
+				time.Sleep(10 * time.Millisecond)
+				running.Add(-1)
+				return true
+			})
+		}()
+	}
+	wg.Wait()
+
+	if peak.Load() > 2 {
+		t.Errorf("Expected at most 2 concurrent scans, got %d", peak.Load())
+	}
+}
+
+func TestCacheMaxConcurrentScansNestedRange(t *testing.T) {
+	cache := cache.New(cache.NewConfig[string, string]().MaxConcurrentScans(1))
+	cache.Set("key1", "value1", time.Minute)
+	cache.Set("key2", "value2", time.Minute)
+
+	done := make(chan int)
+	go func() {
+		visited := 0
+		cache.Range(func(string, string) bool {
+			cache.Range(func(string, string) bool {
+				visited++
+				return true
+			})
+			return true
+		})
+		done <- visited
+	}()
+
+	select {
+	case visited := <-done:
+		if visited != 4 {
+			t.Errorf("Expected the nested Range to visit 4 items, got %d", visited)
+		}
+	case <-time.After(time.Second):
+		t.Fatalf("Expected a nested Range to not deadlock with a single scan allowed")
+	}
+}
+
+func TestCacheSetWithSoftTTL(t *testing.T) {
+	cache := cache.New(cache.NewConfig[string, string]())
+
+	cache.SetWithSoftTTL("key1", "value1", 10*time.Millisecond, time.Second)
+
+	item := cache.Get("key1")
+
+	if item == nil || item.Stale() {
+		t.Fatalf("Expected item to be fresh before the soft TTL")
+	}
+
+	time.Sleep(20 * time.Millisecond)
+
+	item = cache.Get("key1")
+
+	if item == nil {
+		t.Fatalf("Expected item to be returned before the hard TTL")
+	}
+
+	if !item.Stale() {
+		t.Errorf("Expected item to be stale after the soft TTL")
+	}
+
+	if item.Expired() {
+		t.Errorf("Expected item to not be expired before the hard TTL")
+	}
+}
+
+func TestCacheOnEvict(t *testing.T) {
+	var evicted atomic.Int32
+	config := cache.NewConfig[string, int]().MaxSize(10).ItemsToPrune(1).
+		Weigher(func(int) int { return 1 }).
+		OnEvict(func(key string, value int, reason cache.EvictReason) {
+			evicted.Add(1)
+		})
+	cache := cache.New(config)
+
+	for i := range 15 {
+		cache.Set("key"+strconv.Itoa(i), i, time.Minute)
+	}
+	time.Sleep(10 * time.Millisecond)
+
+	if n := evicted.Load(); n != 5 {
+		t.Errorf("Expected 5 callbacks after pruning, got %d", n)
+	}
+
+	cache.Delete("key14")
+	time.Sleep(10 * time.Millisecond)
+
+	if n := evicted.Load(); n != 6 {
+		t.Errorf("Expected 6 callbacks after deleting, got %d", n)
+	}
+
+	cache.Set("key13", 13, time.Minute)
+	time.Sleep(10 * time.Millisecond)
+
+	if n := evicted.Load(); n != 6 {
+		t.Errorf("Expected no callback when replacing with the same value, got %d", n)
+	}
+
+	cache.Clear()
+	time.Sleep(10 * time.Millisecond)
+
+	if n := evicted.Load(); n != 15 {
+		t.Errorf("Expected 15 callbacks after clearing, got %d", n)
+	}
+}
+
+func TestCacheOnEvictReason(t *testing.T) {
+	var mu sync.Mutex
+	reasons := map[cache.EvictReason]int{}
+	config := cache.NewConfig[string, int]().MaxSize(10).ItemsToPrune(1).
+		Weigher(func(int) int { return 1 }).
+		OnEvict(func(key string, value int, reason cache.EvictReason) {
+			mu.Lock()
+			reasons[reason]++
+			mu.Unlock()
+		})
+	c := cache.New(config)
+
+	for i := range 11 {
+		c.Set("key"+strconv.Itoa(i), i, time.Minute)
+		time.Sleep(time.Millisecond)
+	}
+	c.Delete("key10")
+	time.Sleep(5 * time.Millisecond)
+	c.Set("key9", 90, time.Minute)
+	time.Sleep(5 * time.Millisecond)
+	c.Set("expired", 0, time.Millisecond)
+	time.Sleep(5 * time.Millisecond)
+	c.DeleteExpired()
+	time.Sleep(10 * time.Millisecond)
+	c.Clear()
+	time.Sleep(10 * time.Millisecond)
+
+	expected := map[cache.EvictReason]int{
+		cache.Evicted:  1,
+		cache.Deleted:  1,
+		cache.Replaced: 1,
+		cache.Expired:  1,
+		cache.Cleared:  9,
+	}
+	mu.Lock()
+	defer mu.Unlock()
+	if !reflect.DeepEqual(reasons, expected) {
+		t.Errorf("Expected reasons to be %v, got %v", expected, reasons)
+	}
+}
+
+func TestCacheTouchMany(t *testing.T) {
+	config := cache.NewConfig[string, int]().MaxSize(10).ItemsToPrune(1).
+		Weigher(func(int) int { return 1 })
+	cache := cache.New(config)
+
+	for i := range 10 {
+		cache.Set("key"+strconv.Itoa(i), i, time.Minute)
+	}
+	time.Sleep(10 * time.Millisecond)
+
+	touched := cache.TouchMany([]string{"key0", "key1", "key2", "key3", "key4", "missing"})
+
+	if touched != 5 {
+		t.Errorf("Expected 5 keys to be touched, got %d", touched)
+	}
+
+	for i := 10; i < 15; i++ {
+		cache.Set("key"+strconv.Itoa(i), i, time.Minute)
+	}
+	time.Sleep(10 * time.Millisecond)
+
+	for i := range 5 {
+		if cache.Peek("key"+strconv.Itoa(i)) == nil {
+			t.Errorf("Expected touched key%d to be kept", i)
+		}
+	}
+
+	for i := 5; i < 10; i++ {
+		if cache.Peek("key"+strconv.Itoa(i)) != nil {
+			t.Errorf("Expected untouched key%d to be pruned", i)
+		}
+	}
+}
+
+func TestCacheEvictionPolicy(t *testing.T) {
+	tests := []struct {
+		policy cache.Policy
+		kept   bool
+	}{
+		{cache.LRU, false},
+		{cache.LFU, true},
+		{cache.FIFO, false},
+	}
+
+	for _, tt := range tests {
+		config := cache.NewConfig[string, int]().MaxSize(10).ItemsToPrune(1).
+			Weigher(func(int) int { return 1 }).
+			EvictionPolicy(tt.policy)
+		c := cache.New(config)
+
+		c.Set("key0", 0, time.Minute)
+		for range 5 {
+			c.Get("key0")
+		}
+		time.Sleep(10 * time.Millisecond)
+
+		for i := 1; i < 15; i++ {
+			c.Set("key"+strconv.Itoa(i), i, time.Minute)
+		}
+		waitFor(func() bool { return c.Size() == 10 })
+
+		if kept := c.Peek("key0") != nil; kept != tt.kept {
+			t.Errorf("Expected hot key0 kept to be %t with policy %d, got %t", tt.kept, tt.policy, kept)
+		}
+		if c.Peek("key14") == nil {
+			t.Errorf("Expected newest key14 to be kept with policy %d", tt.policy)
+		}
+		c.Close()
+	}
+}
+
+func TestCacheTrimToSize(t *testing.T) {
+	var evicted atomic.Int64
+	c := cache.New(cache.NewConfig[string, int]().MaxSize(100).Weigher(func(int) int { return 1 }).
+		OnEvict(func(string, int, cache.EvictReason) { evicted.Add(1) }))
+
+	for i := range 50 {
+		c.Set("key"+strconv.Itoa(i), i, time.Minute)
+	}
+	time.Sleep(10 * time.Millisecond)
+
+	if n := c.TrimToSize(20); n != 30 {
+		t.Errorf("Expected 30 items to be evicted, got %d", n)
+	}
+	if size := c.Size(); size != 20 {
+		t.Errorf("Expected size to be 20, got %d", size)
+	}
+	if count := c.ItemCount(); count != 20 {
+		t.Errorf("Expected item count to be 20, got %d", count)
+	}
+	if n := evicted.Load(); n != 30 {
+		t.Errorf("Expected OnEvict to be called 30 times, got %d", n)
+	}
+	if c.Peek("key49") == nil {
+		t.Errorf("Expected most recent key49 to be kept")
+	}
+}
+
+func TestCachePressureSignal(t *testing.T) {
+	pressure := make(chan float64)
+	c := cache.New(cache.NewConfig[string, int]().ByCount().MaxSize(100).PressureSignal(pressure))
+	defer c.Close()
+
+	for i := range 80 {
+		c.Set("key"+strconv.Itoa(i), i, time.Minute)
+	}
+	c.Sync()
+
+	pressure <- 0.5
+	waitFor(func() bool { return c.Size() == 50 })
+	if size := c.Size(); size != 50 {
+		t.Errorf("Expected the cache to be trimmed to 50, got %d", size)
+	}
+
+	pressure <- 2
+	time.Sleep(10 * time.Millisecond)
+	if size := c.Size(); size != 50 {
+		t.Errorf("Expected a fullness over 1 to leave the size at 50, got %d", size)
+	}
+	if max := c.MaxSizeValue(); max != 100 {
+		t.Errorf("Expected the max size to be unchanged, got %d", max)
+	}
+}
+
+func TestCacheSetMaxSize(t *testing.T) {
+	c := cache.New(cache.NewConfig[string, int]().MaxSize(100).Weigher(func(int) int { return 1 }))
+
+	for i := range 50 {
+		c.Set("key"+strconv.Itoa(i), i, time.Minute)
+	}
+	time.Sleep(10 * time.Millisecond)
+
+	c.SetMaxSize(20)
+	if size := c.Size(); size != 20 {
+		t.Errorf("Expected shrinking to evict down to 20, got %d", size)
+	}
+	if max := c.MaxSizeValue(); max != 20 {
+		t.Errorf("Expected max size to be 20, got %d", max)
+	}
+
+	c.SetMaxSize(200)
+	for i := 50; i < 150; i++ {
+		c.Set("key"+strconv.Itoa(i), i, time.Minute)
+	}
+	time.Sleep(10 * time.Millisecond)
+	if size := c.Size(); size != 120 {
+		t.Errorf("Expected growing to make room for 120 items, got %d", size)
+	}
+}
+
+func TestCacheEvictKeepsReplacement(t *testing.T) {
+	for _, max := range []int{1, 2} {
+		var mu sync.Mutex
+		callbacks := make(map[int]int)
+		c := cache.New(cache.NewConfig[string, int]().ByCount().MaxSize(max).ItemsToPrune(1).
+			OnEvict(func(key string, value int, _ cache.EvictReason) {
+				if key == "A" {
+					mu.Lock()
+					callbacks[value]++
+					mu.Unlock()
+				}
+			}))
+		c.Set("B", 0, time.Minute)
+		c.Set("C", 0, time.Minute)
+		c.Sync()
+
+		lost := 0
+		for i := range 1000 {
+			c.Set("A", i, time.Minute)
+			c.Sync()
+			if item := c.Get("A"); item == nil || item.Value() != i {
+				lost++
+			}
+		}
+
+		if lost != 0 {
+			t.Errorf("Expected every value just written with max size %d to be kept, lost %d", max, lost)
+		}
+		if size, count := c.Size(), c.ItemCount(); size != count {
+			t.Errorf("Expected size %d to match the item count %d with max size %d", size, count, max)
+		}
+		c.Close()
+		for value, n := range callbacks {
+			if n > 1 {
+				t.Errorf("Expected value %d to be reported once with max size %d, got %d callbacks", value, max, n)
+			}
+		}
+	}
+}
+
+func TestCacheWorkers(t *testing.T) {
+	c := cache.New(cache.NewConfig[string, int]().Workers(4).MaxSize(100).ItemsToPrune(1).
+		Weigher(func(int) int { return 1 }))
+
+	for i := range 150 {
+		c.Set("key"+strconv.Itoa(i), i, time.Minute)
+	}
+	c.Sync()
+
+	if size := c.Size(); size != 100 {
+		t.Errorf("Expected size across workers to be 100, got %d", size)
+	}
+	if count := c.ItemCount(); count != 100 {
+		t.Errorf("Expected item count to be 100, got %d", count)
+	}
+
+	if n := c.TrimToSize(40); n != 60 {
+		t.Errorf("Expected 60 items to be evicted, got %d", n)
+	}
+	c.Clear()
+	if size := c.Size(); size != 0 {
+		t.Errorf("Expected size to be 0 after clearing, got %d", size)
+	}
+}
+
+func TestCacheLRUQueue(t *testing.T) {
+	c := cache.New(cache.NewConfig[string, int]().MaxSize(3).ItemsToPrune(1).Weigher(func(int) int {
+		return 1
+	}))
+
+	// Stored items are pushed to the front of the queue.
+	for _, key := range []string{"a", "b", "c"} {
+		c.Set(key, 0, time.Minute)
+		time.Sleep(5 * time.Millisecond)
+	}
+	// Touched items move to the front and deleted items are removed.
+	c.TouchMany([]string{"a"})
+	c.Delete("b")
+	time.Sleep(5 * time.Millisecond)
+
+	c.Set("d", 0, time.Minute)
+	time.Sleep(5 * time.Millisecond)
+	c.Set("e", 0, time.Minute)
+	waitFor(func() bool { return c.ItemCount() == 3 })
+
+	for key, kept := range map[string]bool{"a": true, "b": false, "c": false, "d": true, "e": true} {
+		if got := c.Peek(key) != nil; got != kept {
+			t.Errorf("Expected %s kept to be %t, got %t", key, kept, got)
+		}
+	}
+}
+
+func TestCachePromoteTimeout(t *testing.T) {
+	block := make(chan struct{})
+	defer close(block)
+	c := cache.New(cache.NewConfig[string, int]().PromoteBuffer(1).PromoteTimeout(10 * time.Millisecond).
+		OnEvict(func(string, int, cache.EvictReason) { <-block }))
+
+	// Keep the worker busy in the OnEvict callback, then fill the promote buffer.
+	c.Set("busy", 0, time.Minute)
+	time.Sleep(5 * time.Millisecond)
+	c.Delete("busy")
+	time.Sleep(5 * time.Millisecond)
+	c.Set("key1", 1, time.Minute)
+
+	start := time.Now()
+	c.Set("key2", 2, time.Minute)
+	if elapsed := time.Since(start); elapsed > time.Second {
+		t.Errorf("Expected Set to give up after the promote timeout, took %s", elapsed)
+	}
+	if dropped := c.Stats().DroppedPromotions; dropped != 1 {
+		t.Errorf("Expected 1 dropped promotion, got %d", dropped)
+	}
+	if item := c.Peek("key2"); item == nil || item.Value() != 2 {
+		t.Errorf("Expected value to be stored despite the dropped promotion")
+	}
+}
+
+func TestCachePromoteTimeoutSampled(t *testing.T) {
+	block := make(chan struct{})
+	c := cache.New(cache.NewConfig[string, int]().ByCount().SampleSize(4).PromoteBuffer(1).
+		PromoteTimeout(time.Millisecond).
+		OnEvict(func(string, int, cache.EvictReason) { <-block }))
+
+	c.Set("busy", 0, time.Minute)
+	time.Sleep(5 * time.Millisecond)
+	c.Delete("busy")
+	time.Sleep(5 * time.Millisecond)
+	c.Set("key1", 1, time.Minute)
+
+	time.AfterFunc(20*time.Millisecond, func() { close(block) })
+	c.Set("key2", 2, time.Minute)
+	c.Sync()
+
+	if dropped := c.Stats().DroppedPromotions; dropped != 0 {
+		t.Errorf("Expected no dropped promotion with sampled eviction, got %d", dropped)
+	}
+	if size := c.Size(); size != 2 {
+		t.Errorf("Expected both items to be tracked, got size %d", size)
+	}
+}
+
+func TestCacheGetsPerPromote(t *testing.T) {
+	for _, gets := range []int{2, 3} {
+		c := cache.New(cache.NewConfig[string, int]().MaxSize(3).ItemsToPrune(1).GetsPerPromote(3).
+			Weigher(func(int) int { return 1 }))
+		for _, key := range []string{"a", "b", "c"} {
+			c.Set(key, 0, time.Minute)
+			time.Sleep(5 * time.Millisecond)
+		}
+
+		for range gets {
+			c.Get("a")
+		}
+		time.Sleep(5 * time.Millisecond)
+		c.Set("d", 0, time.Minute)
+		waitFor(func() bool { return c.ItemCount() == 3 })
+
+		// Only the third Get moves a to the front of the queue, saving it from eviction.
+		if kept, expected := c.Peek("a") != nil, gets >= 3; kept != expected {
+			t.Errorf("Expected a kept to be %t after %d gets, got %t", expected, gets, kept)
+		}
+		c.Close()
+	}
+}
+
+func TestCacheHotKeyStaysCached(t *testing.T) {
+	c := cache.New(cache.NewConfig[string, int]().MaxSize(10).ItemsToPrune(1).Weigher(func(int) int { return 1 }))
+
+	c.Set("hot", 0, time.Minute)
+	for i := range 30 {
+		c.Get("hot")
+		c.Set("key"+strconv.Itoa(i), i, time.Minute)
+		time.Sleep(time.Millisecond)
+	}
+	c.Sync()
+
+	if c.Peek("hot") == nil {
+		t.Errorf("Expected hot key to stay near the front of the queue with the default gets per promote")
+	}
+}
+
+func TestCacheSampledEviction(t *testing.T) {
+	config := cache.NewConfig[string, int]().MaxSize(10).ItemsToPrune(1).
+		Weigher(func(int) int { return 1 }).
+		SampleSize(100)
+	cache := cache.New(config)
+
+	for i := range 10 {
+		cache.Set("key"+strconv.Itoa(i), i, time.Minute)
+	}
+	time.Sleep(10 * time.Millisecond)
+
+	for i := range 5 {
+		cache.Get("key" + strconv.Itoa(i))
+	}
+
+	for i := 10; i < 15; i++ {
+		cache.Set("key"+strconv.Itoa(i), i, time.Minute)
+	}
+	waitFor(func() bool { return cache.ItemCount() == 10 })
+
+	if size := cache.Size(); size != 10 {
+		t.Errorf("Expected size to be 10, got %d", size)
+	}
+	for i := range 5 {
+		if cache.Peek("key"+strconv.Itoa(i)) == nil {
+			t.Errorf("Expected recently accessed key%d to be kept", i)
+		}
+	}
+}
+
+func TestCacheCostFunction(t *testing.T) {
+	clock := &fakeClock{now: time.Unix(1000, 0)}
+	c := cache.New(cache.NewConfig[string, string]().Clock(clock).MaxSize(100).ItemsToPrune(1).SampleSize(100).
+		Weigher(func(value string) int { return len(value) }).
+		CostFunction(func(item *cache.Item[string, string]) float64 {
+			return float64(item.LastAccess().Unix()) - float64(item.Size())
+		}))
+
+	// By recency alone, the small item would be evicted first: it was stored 10 seconds before the large one.
+	c.Set("small", "s", time.Hour)
+	c.Sync()
+	clock.Advance(10 * time.Second)
+	c.Set("large", strings.Repeat("l", 50), time.Hour)
+	c.Set("filler", strings.Repeat("f", 49), time.Hour)
+	c.Sync()
+	clock.Advance(10 * time.Second)
+	c.Set("trigger", "t", time.Hour)
+	c.Sync()
+
+	if c.Has("large") {
+		t.Errorf("Expected the large item to be evicted for its size")
+	}
+	if !c.Has("small") {
+		t.Errorf("Expected the small item to be kept despite being older")
+	}
+}
+
+func TestCacheMemoizeWeights(t *testing.T) {
+	var calls atomic.Int32
+	config := cache.NewConfig[string, *[]byte]().MaxSize(1 << 30).MemoizeWeights().Weigher(func(value *[]byte) int {
+		calls.Add(1)
+		return len(*value)
+	})
+	cache := cache.New(config)
+
+	blob := make([]byte, 1<<20)
+	for i := range 100 {
+		cache.Set("key"+strconv.Itoa(i), &blob, time.Minute)
+	}
+
+	if n := calls.Load(); n != 1 {
+		t.Errorf("Expected weigher to be called once, got %d", n)
+	}
+
+	if item := cache.Get("key42"); item == nil || item.Size() != len(blob) {
+		t.Errorf("Expected memoized weight to be %d", len(blob))
+	}
+
+	for i := range 99 {
+		cache.Delete("key" + strconv.Itoa(i))
+	}
+	cache.Sync()
+	cache.Set("key0", &blob, time.Minute)
+	if n := calls.Load(); n != 1 {
+		t.Errorf("Expected the weight to be remembered while an item holds the value, got %d calls", n)
+	}
+
+	cache.Delete("key0")
+	cache.Delete("key99")
+	cache.Sync()
+	cache.Set("key0", &blob, time.Minute)
+	if n := calls.Load(); n != 2 {
+		t.Errorf("Expected the value to be forgotten once no item holds it, got %d calls", n)
+	}
+}
+
+func TestCacheCleanupInterval(t *testing.T) {
+	cache := cache.New(cache.NewConfig[string, string]().CleanupInterval(5 * time.Millisecond))
+	defer cache.Close()
+
+	cache.Set("key1", "value1", time.Millisecond)
+	cache.Set("key2", "value2", time.Minute)
+
+	waitFor(func() bool { return cache.Peek("key1") == nil })
+
+	if cache.Peek("key1") != nil {
+		t.Errorf("Expected expired item to be removed by the janitor")
+	}
+
+	if cache.Peek("key2") == nil {
+		t.Errorf("Expected live item to be kept by the janitor")
+	}
+
+	if n := cache.Stats().Expirations; n != 1 {
+		t.Errorf("Expected 1 expiration, got %d", n)
+	}
+}
+
+func TestCacheWithoutCleanupInterval(t *testing.T) {
+	cache := cache.New(cache.NewConfig[string, string]())
+	defer cache.Close()
+
+	cache.Set("key1", "value1", time.Millisecond)
+
+	time.Sleep(10 * time.Millisecond)
+
+	if cache.Peek("key1") == nil {
+		t.Errorf("Expected expired item to be kept without a janitor")
+	}
+}
+
+func TestCacheSetWithExpireFunc(t *testing.T) {
+	c := cache.New(cache.NewConfig[string, string]().CleanupInterval(5 * time.Millisecond))
+	expired := make(chan string, 2)
+	onExpire := func(key string, value string) {
+		expired <- key + "=" + value
+	}
+
+	c.SetWithExpireFunc("key1", "value1", 10*time.Millisecond, onExpire)
+	c.SetWithExpireFunc("key2", "value2", 10*time.Millisecond, onExpire)
+	c.Delete("key2")
+
+	select {
+	case got := <-expired:
+		if got != "key1=value1" {
+			t.Errorf("Expected expire callback for key1=value1, got %s", got)
+		}
+	case <-time.After(time.Second):
+		t.Fatalf("Expected expire callback to be called")
+	}
+	select {
+	case got := <-expired:
+		t.Errorf("Expected no expire callback for a deleted item, got %s", got)
+	case <-time.After(30 * time.Millisecond):
+	}
+}
+
+func TestCacheSetNX(t *testing.T) {
+	cache := cache.New(cache.NewConfig[string, int]())
+
+	var inserted atomic.Int32
+	var wg sync.WaitGroup
+	for i := range 10 {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if cache.SetNX("key1", i, time.Second) {
+				inserted.Add(1)
+			}
+		}()
+	}
+	wg.Wait()
+
+	if n := inserted.Load(); n != 1 {
+		t.Errorf("Expected exactly one insert, got %d", n)
+	}
+}
+
+func TestCacheSetNXExpiredItem(t *testing.T) {
+	cache := cache.New(cache.NewConfig[string, string]())
+
+	cache.Set("key1", "value1", time.Nanosecond)
+	time.Sleep(time.Millisecond)
+
+	if !cache.SetNX("key1", "value2", time.Second) {
+		t.Errorf("Expected expired item to be overwritten")
+	}
+
+	if item := cache.Get("key1"); item == nil || item.Value() != "value2" {
+		t.Errorf("Expected item value to be 'value2'")
+	}
+}
+
+func TestCacheNegativeWeightIsClamped(t *testing.T) {
+	var errs atomic.Int32
+	config := cache.NewConfig[string, string]().
+		Weigher(func(string) int { return -5 }).
+		ErrorHandler(func(err error) {
+			if errors.Is(err, cache.ErrInvalidWeight) {
+				errs.Add(1)
+			}
+		})
+	cache := cache.New(config)
+
+	cache.Set("key1", "value1", time.Second)
+
+	item := cache.Get("key1")
+
+	if item == nil {
+		t.Fatalf("Expected item with a clamped weight to be stored")
+	}
+
+	if item.Size() != 0 {
+		t.Errorf("Expected item size to be clamped to 0, got %d", item.Size())
+	}
+
+	if n := errs.Load(); n != 1 {
+		t.Errorf("Expected 1 invalid weight error, got %d", n)
+	}
+}
+
+func TestCacheRejectInvalidWeights(t *testing.T) {
+	var errs atomic.Int32
+	config := cache.NewConfig[string, string]().
+		Weigher(func(value string) int {
+			if value == "panic" {
+				panic("bad value")
+			}
+			return -5
+		}).
+		RejectInvalidWeights().
+		ErrorHandler(func(err error) { errs.Add(1) })
+	cache := cache.New(config)
+
+	cache.Set("key1", "value1", time.Second)
+	cache.Set("key2", "panic", time.Second)
+
+	if cache.Get("key1") != nil || cache.Get("key2") != nil {
+		t.Errorf("Expected items with invalid weights to be rejected")
+	}
+
+	if n := errs.Load(); n != 2 {
+		t.Errorf("Expected 2 invalid weight errors, got %d", n)
+	}
+}
+
+func BenchmarkCacheGetHotKey(b *testing.B) {
+	cache := cache.New(cache.NewConfig[string, string]())
+	cache.Set("key1", "value1", time.Minute)
+
+	b.ReportAllocs()
+	b.ResetTimer()
+	for range b.N {
+		cache.Get("key1")
+	}
+}
+
+func BenchmarkCacheSetParallel(b *testing.B) {
+	for _, workers := range []int{1, 4} {
+		b.Run("workers="+strconv.Itoa(workers), func(b *testing.B) {
+			cache := cache.New(cache.NewConfig[string, int]().Shards(32).Workers(workers).MaxSize(10000).
+				Weigher(func(int) int { return 1 }))
+			defer cache.Close()
+			var next atomic.Int64
+
+			b.ReportAllocs()
+			b.ResetTimer()
+			b.RunParallel(func(pb *testing.PB) {
+				for pb.Next() {
+					i := next.Add(1)
+					cache.Set("key"+strconv.FormatInt(i%20000, 10), int(i), time.Minute)
+				}
+			})
+		})
+	}
+}
+
+func BenchmarkCacheLowWatermark(b *testing.B) {
+	for _, watermark := range []float64{1, 0.9} {
+		b.Run("watermark="+strconv.FormatFloat(watermark, 'f', -1, 64), func(b *testing.B) {
+			var gcs atomic.Int64
+			cache := cache.New(cache.NewConfig[string, int]().ByCount().MaxSize(10000).ItemsToPrune(1).
+				LowWatermark(watermark).GCObserver(func(cache.GCStats) { gcs.Add(1) }))
+			defer cache.Close()
+
+			b.ReportAllocs()
+			b.ResetTimer()
+			for i := range b.N {
+				cache.Set("key"+strconv.Itoa(i), i, time.Minute)
+			}
+			cache.Sync()
+			b.ReportMetric(float64(gcs.Load())/float64(b.N), "gcs/op")
+		})
+	}
+}
+
+func BenchmarkCacheRange(b *testing.B) {
+	cache := cache.New(cache.NewConfig[string, []byte]().ByCount().MaxSize(100000))
+	for i := range 100000 {
+		cache.Set("key"+strconv.Itoa(i), []byte(strconv.Itoa(i)), time.Minute)
+	}
+	cache.Sync()
+	work := func(value []byte) uint32 {
+		h := crc32.ChecksumIEEE(value)
+		for range 16 {
+			h = crc32.Update(h, crc32.IEEETable, value)
+		}
+		return h
+	}
+
+	b.Run("serial", func(b *testing.B) {
+		for range b.N {
+			cache.Range(func(key string, value []byte) bool {
+				work(value)
+				return true
+			})
+		}
+	})
+	b.Run("parallel", func(b *testing.B) {
+		for range b.N {
+			cache.RangeParallel(0, func(key string, value []byte) {
+				work(value)
+			})
+		}
+	})
+}
+
+func BenchmarkCacheDeleteParallel(b *testing.B) {
+	cache := cache.New(cache.NewConfig[string, int]().MaxSize(b.N + 1).DeleteBuffer(16).
+		Weigher(func(int) int { return 1 }).
+		OnEvict(func(string, int, cache.EvictReason) { time.Sleep(time.Microsecond) }))
+	keys := make([]string, b.N)
+	for i := range keys {
+		keys[i] = "key" + strconv.Itoa(i)
+		cache.Set(keys[i], i, time.Minute)
+	}
+	var next atomic.Int64
+
+	b.ReportAllocs()
+	b.ResetTimer()
+	b.RunParallel(func(pb *testing.PB) {
+		for pb.Next() {
+			cache.Delete(keys[next.Add(1)-1])
+		}
+	})
+}
+
+func TestCacheSetWithoutExpiration(t *testing.T) {
+	noExpiration := cache.NoExpiration
+	cache := cache.New(cache.NewConfig[string, string]())
+
+	cache.Set("key1", "value1", 0)
+	cache.Set("key2", "value2", -time.Second)
+
+	time.Sleep(time.Millisecond)
+
+	for _, key := range []string{"key1", "key2"} {
+		item := cache.Get(key)
+
+		if item == nil || item.Expired() {
+			t.Errorf("Expected item '%s' to never expire", key)
+			continue
+		}
+
+		if item.TTL() != noExpiration {
+			t.Errorf("Expected item '%s' TTL to be NoExpiration, got %s", key, item.TTL())
+		}
+	}
+}
+
+func TestCacheSetDefault(t *testing.T) {
+	cache := cache.New(cache.NewConfig[string, string]().DefaultTTL(time.Minute))
+
+	cache.SetDefault("key1", "value1")
+
+	item := cache.Get("key1")
+
+	if item == nil {
+		t.Fatalf("Expected item to be not nil")
+	}
+
+	if ttl := item.TTL(); ttl > time.Minute || ttl < time.Minute-time.Second {
+		t.Errorf("Expected item TTL to be about 1 minute, got %s", ttl)
+	}
+}
+
+func TestCacheSetDefaultWithoutDefaultTTL(t *testing.T) {
+	noExpiration := cache.NoExpiration
+	cache := cache.New(cache.NewConfig[string, string]())
+
+	cache.SetDefault("key1", "value1")
+
+	if item := cache.Get("key1"); item == nil || item.TTL() != noExpiration {
+		t.Errorf("Expected item to never expire without a default TTL")
+	}
+}
+
+func TestCacheTopBy(t *testing.T) {
+	type score struct {
+		Name   string
+		Points int
+	}
+	c := cache.New(cache.NewConfig[string, score]())
+
+	for i, points := range []int{5, 42, 17, 8, 99, 23} {
+		c.Set("key"+strconv.Itoa(i), score{Name: "player" + strconv.Itoa(i), Points: points}, time.Minute)
+	}
+
+	top := c.TopBy(3, func(a, b *cache.Item[string, score]) bool {
+		return a.Value().Points > b.Value().Points
+	})
+
+	expected := []int{99, 42, 23}
+	if len(top) != len(expected) {
+		t.Fatalf("Expected %d items, got %d", len(expected), len(top))
+	}
+
+	for i, item := range top {
+		if item.Value().Points != expected[i] {
+			t.Errorf("Expected item %d to have %d points, got %d", i, expected[i], item.Value().Points)
+		}
+	}
+}
+
+func TestCacheKeys(t *testing.T) {
+	cache := cache.New(cache.NewConfig[string, string]())
+
+	cache.Set("key1", "value1", time.Second)
+	cache.Set("key2", "value2", time.Second)
+	cache.Set("key3", "value3", time.Second)
+
+	keys := cache.Keys()
+	slices.Sort(keys)
+
+	expectedKeys := []string{"key1", "key2", "key3"}
+	if !reflect.DeepEqual(keys, expectedKeys) {
+		t.Errorf("Expected keys to be %v, got %v", expectedKeys, keys)
+	}
+}
+
+func TestCacheSize(t *testing.T) {
+	cache := cache.New(cache.NewConfig[string, []byte]().MaxSize(10000).Weigher(func(value []byte) int {
+		return len(value)
+	}))
+
+	cache.Set("key1", make([]byte, 100), time.Minute)
+	cache.Set("key2", make([]byte, 250), time.Minute)
+	time.Sleep(10 * time.Millisecond)
+
+	if size := cache.Size(); size != 350 {
+		t.Errorf("Expected size to be 350, got %d", size)
+	}
+
+	if max := cache.MaxSizeValue(); max != 10000 {
+		t.Errorf("Expected max size to be 10000, got %d", max)
+	}
+}
+
+func TestCacheGCSettlesUnderMaxSize(t *testing.T) {
+	t.Run("bytes", func(t *testing.T) {
+		c := cache.New(cache.NewConfig[string, []byte]().MaxSize(1000).ItemsToPrune(1).Weigher(func(value []byte) int {
+			return len(value)
+		}))
+
+		for i := range 100 {
+			c.Set("key"+strconv.Itoa(i), make([]byte, 10), time.Minute)
+		}
+		c.Set("large", make([]byte, 500), time.Minute)
+		c.Sync()
+
+		if size := c.Size(); size != 1000 {
+			t.Errorf("Expected size to settle at 1000, got %d", size)
+		}
+		if count := c.ItemCount(); count != 51 {
+			t.Errorf("Expected 50 small items to be evicted for the large one, got %d items", count)
+		}
+	})
+
+	t.Run("count", func(t *testing.T) {
+		c := cache.New(cache.NewConfig[string, int]().ByCount().MaxSize(100).ItemsToPrune(1))
+
+		for i := range 150 {
+			c.Set("key"+strconv.Itoa(i), i, time.Minute)
+		}
+		c.Sync()
+
+		if size := c.Size(); size != 100 {
+			t.Errorf("Expected size to settle at 100, got %d", size)
+		}
+	})
+}
+
+func TestCacheLowWatermark(t *testing.T) {
+	c := cache.New(cache.NewConfig[string, int]().ByCount().MaxSize(100).ItemsToPrune(1).LowWatermark(0.9))
+
+	for i := range 101 {
+		c.Set("key"+strconv.Itoa(i), i, time.Minute)
+	}
+	c.Sync()
+
+	if size := c.Size(); size != 90 {
+		t.Errorf("Expected pruning to bring the size down to 90, got %d", size)
+	}
+}
+
+func TestCacheLastAccess(t *testing.T) {
+	cache := cache.New(cache.NewConfig[string, string]())
+	cache.Set("key1", "value1", time.Minute)
+
+	if accessed := cache.Peek("key1").LastAccess(); !accessed.IsZero() {
+		t.Errorf("Expected item that was never read to have no last access, got %s", accessed)
+	}
+
+	before := time.Now()
+	cache.Get("key1")
+	after := time.Now()
+
+	if accessed := cache.Peek("key1").LastAccess(); accessed.Before(before) || accessed.After(after) {
+		t.Errorf("Expected last access to be between %s and %s, got %s", before, after, accessed)
+	}
+}
+
+func TestCacheByCount(t *testing.T) {
+	cache := cache.New(cache.NewConfig[string, []byte]().ByCount().MaxSize(100).ItemsToPrune(10))
+
+	for i := range 150 {
+		cache.Set("key"+strconv.Itoa(i), make([]byte, 1000), time.Minute)
+	}
+	time.Sleep(10 * time.Millisecond)
+
+	if count := cache.ItemCount(); count < 90 || count > 100 {
+		t.Errorf("Expected item count to be near 100, got %d", count)
+	}
+	if size := cache.Size(); size != cache.ItemCount() {
+		t.Errorf("Expected size to be the item count %d, got %d", cache.ItemCount(), size)
+	}
+}
+
+func TestCacheSync(t *testing.T) {
+	c := cache.New(cache.NewConfig[string, int]().MaxSize(1000).Weigher(func(int) int { return 1 }))
+
+	for i := range 100 {
+		c.Set("key"+strconv.Itoa(i), i, time.Minute)
+	}
+	for i := range 10 {
+		c.Delete("key" + strconv.Itoa(i))
+	}
+	c.Sync()
+
+	if size := c.Size(); size != 90 {
+		t.Errorf("Expected size to be 90 once synced, got %d", size)
+	}
+}
+
+func TestCacheHas(t *testing.T) {
+	cache := cache.New(cache.NewConfig[string, string]())
+
+	cache.Set("key1", "value1", time.Second)
+	cache.Set("key2", "value2", time.Nanosecond)
+	time.Sleep(time.Millisecond)
+
+	if !cache.Has("key1") {
+		t.Errorf("Expected live key to exist")
+	}
+
+	if cache.Has("key2") {
+		t.Errorf("Expected expired key to not exist")
+	}
+
+	if cache.Has("key3") {
+		t.Errorf("Expected missing key to not exist")
+	}
+}
+
+func TestCacheGetMulti(t *testing.T) {
+	cache := cache.New(cache.NewConfig[string, string]())
+
+	cache.Set("key1", "value1", time.Second)
+	cache.Set("key2", "value2", time.Second)
+	cache.Set("key3", "value3", time.Second)
+
+	items := cache.GetMulti([]string{"key1", "key3", "missing"})
+
+	if len(items) != 2 {
+		t.Fatalf("Expected 2 items, got %d", len(items))
+	}
+
+	if item := items["key1"]; item == nil || item.Value() != "value1" {
+		t.Errorf("Expected key1 to be found with 'value1'")
+	}
+
+	if item := items["key3"]; item == nil || item.Value() != "value3" {
+		t.Errorf("Expected key3 to be found with 'value3'")
+	}
+
+	if _, ok := items["missing"]; ok {
+		t.Errorf("Expected missing key to be absent from the result")
+	}
+}
+
+func BenchmarkCacheGetMulti(b *testing.B) {
+	cache := cache.New(cache.NewConfig[string, int]())
+	keys := make([]string, 100)
+	for i := range keys {
+		keys[i] = "key" + strconv.Itoa(i)
+		cache.Set(keys[i], i, time.Minute)
+	}
+
+	b.Run("GetMulti", func(b *testing.B) {
+		b.ReportAllocs()
+		for range b.N {
+			cache.GetMulti(keys)
+		}
+	})
+
+	b.Run("Get", func(b *testing.B) {
+		b.ReportAllocs()
+		for range b.N {
+			for _, key := range keys {
+				cache.Get(key)
+			}
+		}
+	})
+}
+
+func TestCacheSetMulti(t *testing.T) {
+	cache := cache.New(cache.NewConfig[string, string]().Weigher(func(string) int { return 1 }))
+
+	cache.Set("key1", "old", time.Second)
+	cache.SetMulti(map[string]string{
+		"key1": "value1",
+		"key2": "value2",
+		"key3": "value3",
+	}, time.Second)
+	time.Sleep(10 * time.Millisecond)
+
+	if count := cache.ItemCount(); count != 3 {
+		t.Errorf("Expected item count to be 3, got %d", count)
+	}
+
+	if item := cache.Get("key1"); item == nil || item.Value() != "value1" {
+		t.Errorf("Expected key1 to be replaced with 'value1'")
+	}
+
+	if size := cache.Size(); size != 3 {
+		t.Errorf("Expected size to be 3 after replacing key1, got %d", size)
+	}
+}
+
+func TestCacheDeleteMulti(t *testing.T) {
+	cache := cache.New(cache.NewConfig[string, string]().Weigher(func(string) int { return 1 }))
+
+	cache.Set("key1", "value1", time.Second)
+	cache.Set("key2", "value2", time.Second)
+	cache.Set("key3", "value3", time.Second)
+
+	cache.DeleteMulti([]string{"key1", "key3", "missing"})
+	time.Sleep(10 * time.Millisecond)
+
+	if count := cache.ItemCount(); count != 1 {
+		t.Errorf("Expected item count to be 1, got %d", count)
+	}
+
+	if cache.Get("key2") == nil {
+		t.Errorf("Expected key2 to be kept")
+	}
+
+	if size := cache.Size(); size != 1 {
+		t.Errorf("Expected size to be 1, got %d", size)
+	}
+}
+
+func TestCacheSlidingTTL(t *testing.T) {
+	cache := cache.New(cache.NewConfig[string, string]().SlidingTTL())
+
+	cache.Set("key1", "value1", 100*time.Millisecond)
+	cache.Set("key2", "value2", 100*time.Millisecond)
+
+	for range 8 {
+		time.Sleep(20 * time.Millisecond)
+		if item := cache.Get("key1"); item == nil || item.Expired() {
+			t.Fatalf("Expected accessed item to stay alive")
+		}
+	}
+
+	if item := cache.Peek("key2"); item == nil || !item.Expired() {
+		t.Errorf("Expected item that was not accessed to expire")
+	}
+
+	time.Sleep(150 * time.Millisecond)
+
+	if item := cache.Peek("key1"); item == nil || !item.Expired() {
+		t.Errorf("Expected item to expire once no longer accessed")
+	}
+}
+
+func TestCacheMaxItemSize(t *testing.T) {
+	config := cache.NewConfig[string, string]().MaxSize(100).MaxItemSize(10).
+		Weigher(func(value string) int { return len(value) })
+	c := cache.New(config)
+
+	if err := c.SetWithResult("small", "value", time.Minute); err != nil {
+		t.Errorf("Expected small value to be stored, got %v", err)
+	}
+	if err := c.SetWithResult("large", strings.Repeat("x", 11), time.Minute); !errors.Is(err, cache.ErrItemTooLarge) {
+		t.Errorf("Expected error to be %v, got %v", cache.ErrItemTooLarge, err)
+	}
+	waitFor(func() bool { return c.Size() == 5 })
+
+	if c.Peek("large") != nil {
+		t.Errorf("Expected large value to not be stored")
+	}
+	if size := c.Size(); size != 5 {
+		t.Errorf("Expected size to be 5, got %d", size)
+	}
+	if rejected := c.Stats().Rejected; rejected != 1 {
+		t.Errorf("Expected 1 rejected item, got %d", rejected)
+	}
+}
+
+func TestCacheSetWithResultCacheFull(t *testing.T) {
+	config := cache.NewConfig[string, string]().MaxSize(10).Weigher(func(value string) int { return len(value) })
+	c := cache.New(config)
+
+	if err := c.SetWithResult("key1", strings.Repeat("x", 10), time.Minute); err != nil {
+		t.Errorf("Expected value filling the cache to be stored, got %v", err)
+	}
+	if err := c.SetWithResult("key2", strings.Repeat("x", 11), time.Minute); !errors.Is(err, cache.ErrCacheFull) {
+		t.Errorf("Expected error to be %v, got %v", cache.ErrCacheFull, err)
+	}
+	if c.Peek("key2") != nil {
+		t.Errorf("Expected value larger than the cache to not be stored")
+	}
+}
+
+func TestCacheGetWithExpiry(t *testing.T) {
+	cache := cache.New(cache.NewConfig[string, string]())
+
+	cache.Set("key1", "value1", time.Minute)
+	cache.Set("key2", "value2", time.Millisecond)
+	time.Sleep(5 * time.Millisecond)
+
+	value, ttl, ok := cache.GetWithExpiry("key1")
+	if !ok || value != "value1" {
+		t.Errorf("Expected key1 to be found with 'value1', got '%s' and %t", value, ok)
+	}
+	if ttl > time.Minute || ttl < time.Minute-time.Second {
+		t.Errorf("Expected TTL to be about 1 minute, got %s", ttl)
+	}
+
+	for _, key := range []string{"key2", "missing"} {
+		if value, ttl, ok := cache.GetWithExpiry(key); ok || value != "" || ttl != 0 {
+			t.Errorf("Expected %s to not be found, got '%s', %s and %t", key, value, ttl, ok)
+		}
+	}
+}
+
+func TestCacheGetValue(t *testing.T) {
+	cache := cache.New(cache.NewConfig[string, string]())
+	cache.Set("key1", "value1", time.Minute)
+	cache.Set("key2", "value2", time.Nanosecond)
+	time.Sleep(time.Millisecond)
+
+	if value, ok := cache.GetValue("key1"); !ok || value != "value1" {
+		t.Errorf("Expected value1 for a live key, got '%s' and %t", value, ok)
+	}
+	if value, ok := cache.GetValue("key2"); ok || value != "" {
+		t.Errorf("Expected no value for an expired key, got '%s' and %t", value, ok)
+	}
+	if value, ok := cache.GetValue("key3"); ok || value != "" {
+		t.Errorf("Expected no value for a missing key, got '%s' and %t", value, ok)
+	}
+}
+
+func TestCacheGetAndRefresh(t *testing.T) {
+	cache := cache.New(cache.NewConfig[string, string]())
+	cache.Set("key1", "value1", time.Second)
+	cache.Set("key2", "value2", time.Nanosecond)
+	time.Sleep(time.Millisecond)
+
+	item, ok := cache.GetAndRefresh("key1", time.Minute)
+	if !ok || item.Value() != "value1" {
+		t.Fatalf("Expected value1 to be returned")
+	}
+	if ttl := item.TTL(); ttl < time.Minute-time.Second {
+		t.Errorf("Expected TTL to be refreshed to 1 minute, got %s", ttl)
+	}
+	if _, ok := cache.GetAndRefresh("key2", time.Minute); ok {
+		t.Errorf("Expected expired item to not be found")
+	}
+	if !cache.Peek("key2").Expired() {
+		t.Errorf("Expected expired item to not be refreshed")
+	}
+	if _, ok := cache.GetAndRefresh("key3", time.Minute); ok {
+		t.Errorf("Expected missing key to not be found")
+	}
+}
+
+func TestCacheHashFunc(t *testing.T) {
+	const keys = 4096
+	itemCounts := func(config *cache.Config[string, int]) []int {
+		c := cache.New(config.MaxSize(1 << 20))
+		for i := range keys {
+			c.Set("tenant:"+strconv.Itoa(i)+":session", i, time.Minute)
+		}
+		var counts []int
+		for _, s := range c.ShardStats() {
+			counts = append(counts, s.ItemCount)
+		}
+		return counts
+	}
+
+	mean := keys / 16
+	for i, n := range itemCounts(cache.NewConfig[string, int]()) {
+		if n < mean*7/10 || n > mean*13/10 {
+			t.Errorf("Expected shard %d to hold about %d keys with the default hash, got %d", i, mean, n)
+		}
+	}
+
+	sequential := func(key string) uint32 {
+		n, _ := strconv.Atoi(strings.Split(key, ":")[1])
+		return uint32(n)
+	}
+	for i, n := range itemCounts(cache.NewConfig[string, int]().HashFunc(sequential)) {
+		if n != mean {
+			t.Errorf("Expected shard %d to hold exactly %d keys with the custom hash, got %d", i, mean, n)
+		}
+	}
+}
+
+func TestCacheStructKeys(t *testing.T) {
+	type userResource struct {
+		user, resource int
+	}
+	config := cache.NewConfig[userResource, string]().
+		HashFunc(func(key userResource) uint32 { return uint32(key.user*31 + key.resource) })
+	cache := cache.New(config)
+
+	cache.Set(userResource{1, 2}, "value1", time.Minute)
+	cache.Set(userResource{2, 1}, "value2", time.Minute)
+
+	if item := cache.Get(userResource{1, 2}); item == nil || item.Value() != "value1" {
+		t.Errorf("Expected value1 for {1 2}")
+	}
+	if item := cache.Get(userResource{2, 1}); item == nil || item.Key() != (userResource{2, 1}) {
+		t.Errorf("Expected item for {2 1} to keep its key")
+	}
+
+	cache.Delete(userResource{1, 2})
+	if cache.Get(userResource{1, 2}) != nil {
+		t.Errorf("Expected {1 2} to be deleted")
+	}
+}
+
+func TestCacheNamedKeyTypes(t *testing.T) {
+	type userID string
+	type orderID int64
+
+	config, err := cache.NewConfig[userID, string]().Build()
+	if err != nil {
+		t.Fatalf("Expected named string keys to have a default hash, got %v", err)
+	}
+	users := cache.New(config)
+	users.Set("alice", "value1", time.Minute)
+	if item := users.Get("alice"); item == nil || item.Value() != "value1" {
+		t.Errorf("Expected value1 for alice")
+	}
+
+	orderConfig, err := cache.NewConfig[orderID, string]().MaxSize(1 << 20).Build()
+	if err != nil {
+		t.Fatalf("Expected named integer keys to have a default hash, got %v", err)
+	}
+	orders := cache.New(orderConfig)
+	for i := range orderID(4096) {
+		orders.Set(i, "order", time.Minute)
+	}
+	for i, s := range orders.ShardStats() {
+		if s.ItemCount < 4096/16*7/10 || s.ItemCount > 4096/16*13/10 {
+			t.Errorf("Expected shard %d to hold about %d keys, got %d", i, 4096/16, s.ItemCount)
+		}
+	}
+}
+
+func TestCacheIntegerKeys(t *testing.T) {
+	cache := cache.New(cache.NewConfig[int, int]().MaxSize(1 << 20).ShardCounters())
+
+	for i := range 1024 {
+		cache.Set(i, i*i, time.Minute)
+	}
+
+	if item := cache.Get(12); item == nil || item.Value() != 144 {
+		t.Errorf("Expected 144 for key 12")
+	}
+	for i, s := range cache.ShardStats() {
+		if s.ItemCount == 0 {
+			t.Errorf("Expected consecutive integer keys to reach shard %d", i)
+		}
+	}
+	if items := cache.Filter("12"); len(items) != 21 {
+		t.Errorf("Expected 21 keys containing '12', got %d", len(items))
+	}
+}
+
+func TestCacheDeleteExpired(t *testing.T) {
+	var evicted atomic.Int32
+	config := cache.NewConfig[string, string]().OnEvict(func(key string, value string, reason cache.EvictReason) {
+		evicted.Add(1)
+	})
+	c := cache.New(config)
+
+	c.Set("key1", "value1", time.Millisecond)
+	c.Set("key2", "value2", time.Millisecond)
+	c.Set("key3", "value3", time.Minute)
+	time.Sleep(5 * time.Millisecond)
+
+	if removed := c.DeleteExpired(); removed != 2 {
+		t.Errorf("Expected 2 expired items to be removed, got %d", removed)
+	}
+	waitFor(func() bool { return evicted.Load() == 2 })
+
+	if n := c.ItemCount(); n != 1 {
+		t.Errorf("Expected 1 item left, got %d", n)
+	}
+	if n := evicted.Load(); n != 2 {
+		t.Errorf("Expected 2 callbacks, got %d", n)
+	}
+	if expirations := c.Stats().Expirations; expirations != 2 {
+		t.Errorf("Expected 2 expirations, got %d", expirations)
+	}
+	if removed := c.DeleteExpired(); removed != 0 {
+		t.Errorf("Expected nothing left to remove, got %d", removed)
+	}
+}
+
+func TestCacheRangePrefix(t *testing.T) {
+	cache := cache.New(cache.NewConfig[string, int]())
+
+	cache.Set("user:1:name", 1, time.Minute)
+	cache.Set("user:1:mail", 2, time.Minute)
+	cache.Set("user:12:name", 3, time.Minute)
+	cache.Set("group:user:1", 4, time.Minute)
+
+	var keys []string
+	cache.RangePrefix("user:1:", func(key string, value int) bool {
+		keys = append(keys, key)
+		return true
+	})
+	slices.Sort(keys)
+
+	if expected := []string{"user:1:mail", "user:1:name"}; !slices.Equal(keys, expected) {
+		t.Errorf("Expected keys %v, got %v", expected, keys)
+	}
+}
+
+func TestCacheDeletePrefix(t *testing.T) {
+	c := cache.New(cache.NewConfig[string, int]())
+
+	c.Set("user:1:name", 1, time.Minute)
+	c.Set("user:1:mail", 2, time.Minute)
+	c.Set("user:12:name", 3, time.Minute)
+	waitFor(func() bool { return c.Size() > 0 })
+
+	if removed := c.DeletePrefix("user:1:"); removed != 2 {
+		t.Errorf("Expected 2 items to be removed, got %d", removed)
+	}
+
+	if c.Get("user:1:name") != nil || c.Get("user:1:mail") != nil {
+		t.Errorf("Expected prefixed keys to be deleted")
+	}
+	if c.Get("user:12:name") == nil {
+		t.Errorf("Expected other keys to be kept")
+	}
+}
+
+func TestCacheFilterFunc(t *testing.T) {
+	cache := cache.New(cache.NewConfig[string, int]())
+
+	for i := range 10 {
+		cache.Set("key"+strconv.Itoa(i), i, time.Minute)
+	}
+
+	filtered := cache.FilterFunc(func(key string) bool {
+		return key == "key2" || key == "key7"
+	})
+
+	var values []int
+	for _, item := range filtered {
+		values = append(values, item.Value())
+	}
+	slices.Sort(values)
+
+	if !slices.Equal(values, []int{2, 7}) {
+		t.Errorf("Expected values [2 7], got %v", values)
+	}
+	if hits := cache.Stats().Hits; hits != 0 {
+		t.Errorf("Expected filtering to not count as gets, got %d hits", hits)
+	}
+}
+
+func TestCacheTTLJitter(t *testing.T) {
+	cache := cache.New(cache.NewConfig[string, int]().MaxSize(1 << 20).TTLJitter(0.5))
+
+	for i := range 100 {
+		cache.Set("key"+strconv.Itoa(i), i, time.Minute)
+	}
+
+	spread := false
+	first := cache.Peek("key0").TTL()
+	for i := range 100 {
+		ttl := cache.Peek("key" + strconv.Itoa(i)).TTL()
+		if ttl < 30*time.Second-time.Second || ttl > 90*time.Second {
+			t.Errorf("Expected TTL to be within 50%% of 1 minute, got %s", ttl)
+		}
+		if ttl < first-time.Second || ttl > first+time.Second {
+			spread = true
+		}
+	}
+
+	if !spread {
+		t.Errorf("Expected jittered TTLs to be spread out")
+	}
+}
+
+func TestCacheCompareAndSwap(t *testing.T) {
+	cache := cache.New(cache.NewConfig[string, int]())
+	eq := func(a, b int) bool { return a == b }
+
+	cache.Set("key1", 1, time.Minute)
+	cache.Set("key2", 1, time.Millisecond)
+	time.Sleep(5 * time.Millisecond)
+
+	if cache.CompareAndSwap("key1", 2, 3, eq) {
+		t.Errorf("Expected swap from a different value to fail")
+	}
+	if !cache.CompareAndSwap("key1", 1, 2, eq) {
+		t.Errorf("Expected swap from the current value to succeed")
+	}
+	if item := cache.Get("key1"); item == nil || item.Value() != 2 {
+		t.Errorf("Expected swapped value to be 2")
+	} else if ttl := item.TTL(); ttl < time.Minute-time.Second {
+		t.Errorf("Expected swapped item to keep its TTL, got %s", ttl)
+	}
+	if cache.CompareAndSwap("key2", 1, 2, eq) {
+		t.Errorf("Expected swap of an expired item to fail")
+	}
+	if cache.CompareAndSwap("missing", 0, 1, eq) {
+		t.Errorf("Expected swap of a missing key to fail")
+	}
+}
+
+func TestCacheCompareAndSwapIsAtomic(t *testing.T) {
+	cache := cache.New(cache.NewConfig[string, int]())
+	eq := func(a, b int) bool { return a == b }
+	cache.Set("counter", 0, time.Minute)
+
+	var wg sync.WaitGroup
+	for range 8 {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for range 100 {
+				for {
+					current := cache.Peek("counter").Value()
+					if cache.CompareAndSwap("counter", current, current+1, eq) {
+						break
+					}
+				}
+			}
+		}()
+	}
+	wg.Wait()
+
+	if value := cache.Peek("counter").Value(); value != 800 {
+		t.Errorf("Expected counter to be 800, got %d", value)
+	}
+}
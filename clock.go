@@ -0,0 +1,18 @@
+package cache
+
+import "time"
+
+// Clock tells the cache the current time, which decides when items expire.
+// The cache reads the system time unless the configuration sets a Clock,
+// typically a fake one that tests advance instead of sleeping.
+type Clock interface {
+	Now() time.Time
+}
+
+// now returns the current time of the clock in nanoseconds, reading the system time for a nil clock.
+func now(clock Clock) int64 {
+	if clock == nil {
+		return time.Now().UnixNano()
+	}
+	return clock.Now().UnixNano()
+}
@@ -1,44 +1,112 @@
 package cache
 
-type Config struct {
-	shards         int
-	maxSize        int
-	itemsToPrune   int
-	deleteBuffer   int
-	promoteBuffer  int
-	getsPerPromote int
-	byBytes        bool
-	byCount        bool
-	freeListSize   int
-}
-
-func NewConfig() *Config {
-	return &Config{
-		shards:        16,
-		maxSize:       5000,
-		byBytes:       true,
-		byCount:       false,
-		itemsToPrune:  500,
-		deleteBuffer:  1024,
-		promoteBuffer: 1024,
-		freeListSize:  10,
+import (
+	"fmt"
+	"reflect"
+	"runtime"
+	"time"
+)
+
+type Config[K comparable, V any] struct {
+	shards               int
+	maxSize              int
+	itemsToPrune         int
+	lowWatermark         float64
+	deleteBuffer         int
+	promoteBuffer        int
+	promoteTimeout       time.Duration
+	workers              int
+	getsPerPromote       int
+	byBytes              bool
+	byCount              bool
+	weigher              func(value V) int
+	maxScans             int
+	onEvict              func(key K, value V, reason EvictReason)
+	shardCounters        bool
+	memoizeWeight        bool
+	cleanupInterval      time.Duration
+	errorHandler         func(err error)
+	rejectInvalidWeights bool
+	gcObserver           func(stats GCStats)
+	maxKeyLength         int
+	digestLongKeys       bool
+	defaultTTL           time.Duration
+	budget               *Budget
+	loaderOutageWindow   time.Duration
+	evictionPolicy       Policy
+	sampleSize           int
+	slidingTTL           bool
+	maxItemSize          int
+	explicitShards       bool
+	hashFunc             func(key K) uint32
+	ttlJitter            float64
+	loader               func(key K) (V, time.Duration, error)
+	pressure             <-chan float64
+	copier               func(value V) V
+	clock                Clock
+	metricsPrefix        string
+	maxTTL               time.Duration
+	minTTL               time.Duration
+	costFunction         func(item *Item[K, V]) float64
+	staleGrace           time.Duration
+}
+
+func NewConfig[K comparable, V any]() *Config[K, V] {
+	return &Config[K, V]{
+		shards:         16,
+		maxSize:        5000,
+		byBytes:        true,
+		byCount:        false,
+		itemsToPrune:   500,
+		lowWatermark:   1,
+		deleteBuffer:   1024,
+		promoteBuffer:  1024,
+		workers:        1,
+		getsPerPromote: 3,
+		metricsPrefix:  "cache",
 	}
 }
 
 // Shards sets the number of shards in the configuration.
 // It takes an integer count as a parameter and updates the configuration's shard count.
 // If the count is not a power of 2, the configuration remains unchanged.
-func (c *Config) Shards(count int) *Config {
+func (c *Config[K, V]) Shards(count int) *Config[K, V] {
 	if count == 0 || count&(count-1) != 0 {
 		return c
 	}
 	c.shards = count
+	c.explicitShards = true
+	return c
+}
+
+const (
+	minAutoShards = 4
+	maxAutoShards = 256
+)
+
+// AutoShards sizes the shards from the number of CPUs usable by the program: the count is the smallest
+// power of 2 at or above runtime.GOMAXPROCS(0), clamped between 4 and 256.
+// A count set with Shards takes precedence, whether it is set before or after AutoShards.
+func (c *Config[K, V]) AutoShards() *Config[K, V] {
+	if c.explicitShards {
+		return c
+	}
+	c.shards = autoShards(runtime.GOMAXPROCS(0))
 	return c
 }
 
+// autoShards returns the shard count picked by AutoShards for the given number of CPUs.
+func autoShards(procs int) int {
+	count := minAutoShards
+	for count < procs && count < maxAutoShards {
+		count <<= 1
+	}
+	return count
+}
+
 // MaxSize sets the maximum size for the cache.
 // It takes an integer value representing the maximum size in bytes (or count).
-func (c *Config) MaxSize(size int) *Config {
+func (c *Config[K, V]) MaxSize(size int) *Config[K, V] {
 	c.maxSize = size
 	return c
 }
@@ -47,50 +115,407 @@ func (c *Config) MaxSize(size int) *Config {
 // If this is set to true, the cache will be bytes-based instead of count-based.
 // The maxSize parameter represents the maximum number of bytes that the cache can store.
 // When the cache reaches its maximum capacity, the least recently used items will be evicted
-func (c *Config) ByBytes() *Config {
+func (c *Config[K, V]) ByBytes() *Config[K, V] {
 	c.byBytes = true
 	c.byCount = false
 	return c
 }
 
 // ByCount sets the cache capacity to be managed by the number of items in the cache.
-// If this is set to true, the cache will be count-based instead of bytes-based.
+// If this is set to true, the cache will be count-based instead of bytes-based:
+// every item weighs 1, ignoring any Weigher, so Size is the number of tracked items.
 // The maxSize parameter represents the maximum number of objects that the cache can store.
 // It is recommended to set an appropriate maxSize value when using ByCount, as the default value may be too big.
-func (c *Config) ByCount() *Config {
+func (c *Config[K, V]) ByCount() *Config[K, V] {
 	c.byBytes = false
 	c.byCount = true
 	return c
 }
 
 // ItemsToPrune sets the number of items to prune in the cache.
-// This determines the number of items that will be pruned from the cache once the maxSize is hit.
-func (c *Config) ItemsToPrune(count int) *Config {
+// This determines the minimum number of items that will be pruned from the cache once the maxSize is hit;
+// more are pruned if needed to bring the size back under maxSize.
+func (c *Config[K, V]) ItemsToPrune(count int) *Config[K, V] {
 	c.itemsToPrune = count
 	return c
 }
 
+// LowWatermark sets the fraction of the max size that pruning brings the cache back down to, 1 by default.
+// With a fraction below 1, such as 0.9, each prune frees more room, so a cache under steady insert
+// pressure prunes less often instead of going over its max size again on almost every insert.
+// The fraction must be in (0, 1].
+func (c *Config[K, V]) LowWatermark(fraction float64) *Config[K, V] {
+	c.lowWatermark = fraction
+	return c
+}
+
 // DeleteBuffer sets the size of the delete buffer in the Config struct.
 // The delete buffer is used to store deleted items temporarily before they are permanently removed.
 // The size parameter specifies the maximum number of items that can be stored in the delete buffer.
-func (c *Config) DeleteBuffer(size int) *Config {
+func (c *Config[K, V]) DeleteBuffer(size int) *Config[K, V] {
 	c.deleteBuffer = size
 	return c
 }
 
-func (c *Config) PromoteBuffer(size int) *Config {
+// GetsPerPromote sets how many Gets of an item it takes to move it to the front of the LRU queue, 3 by default.
+// Moving items less often spares the worker on hot keys at the cost of a less accurate eviction order;
+// 1 moves an item on every Get. It only applies to the LRU policy.
+func (c *Config[K, V]) GetsPerPromote(n int) *Config[K, V] {
+	c.getsPerPromote = n
+	return c
+}
+
+func (c *Config[K, V]) PromoteBuffer(size int) *Config[K, V] {
 	c.promoteBuffer = size
 	return c
 }
 
-// FreeListSize sets the size of the free list as a percentage of the actual size, the max size.
-// The size parameter should be a value between 0 and 100, representing the percentage.
-// If the size is less than 0 or greater than 100, the method does nothing and returns the current configuration.
-// Returns the updated Config object.
-func (c *Config) FreeListSize(size int) *Config {
-	if size < 0 || size > 100 {
+// PromoteTimeout bounds how long Set and the other writes wait for room in the promote buffer
+// when the worker falls behind. Past the timeout the promotion is dropped and counted in
+// Stats.DroppedPromotions: the value is stored, but it is only tracked by the eviction policy
+// and counted in Size once a Get promotes it again. Dropping promotions degrades the accuracy
+// of the eviction order and of the size accounting, but keeps bursts of writes from stalling.
+// A timeout of 0, the default, makes writes wait as long as needed, and so does sampled eviction,
+// with SampleSize or CostFunction, where Get never promotes an item again.
+func (c *Config[K, V]) PromoteTimeout(d time.Duration) *Config[K, V] {
+	c.promoteTimeout = d
+	return c
+}
+
+// Workers sets the number of goroutines processing promotions and deletions, 1 by default.
+// The shards are split between the workers, each keeping its own eviction order and size,
+// so writes to keys of different workers are processed in parallel. The max size still applies
+// to the sum of their sizes, but a worker only evicts its own items: eviction follows the policy
+// within each worker rather than across the whole cache. The count cannot exceed the number of shards.
+func (c *Config[K, V]) Workers(n int) *Config[K, V] {
+	c.workers = n
+	return c
+}
+
+// FreeListSize used to size the free list that released items were recycled through.
+//
+// Deprecated: released items are no longer recycled, since callers and queued deletions
+// may still reference them, so this setting has no effect.
+func (c *Config[K, V]) FreeListSize(size int) *Config[K, V] {
+	return c
+}
+
+// MetricsPrefix sets the prefix of the metric names written by WriteMetrics, "cache" by default,
+// so that several caches of a program can be told apart. It must be a valid Prometheus metric name.
+func (c *Config[K, V]) MetricsPrefix(prefix string) *Config[K, V] {
+	c.metricsPrefix = prefix
+	return c
+}
+
+// Clock sets the clock deciding when items expire and become stale, instead of the system time.
+// It also dates the accesses reported by LastAccess. The janitor started by CleanupInterval
+// still runs on a real ticker, but uses the clock to tell which items have expired.
+func (c *Config[K, V]) Clock(clk Clock) *Config[K, V] {
+	c.clock = clk
+	return c
+}
+
+// Copier sets the function Item.ValueCopy uses to copy values, typically a deep copy for values
+// holding slices, maps or pointers that callers must not modify in place.
+func (c *Config[K, V]) Copier(fn func(value V) V) *Config[K, V] {
+	c.copier = fn
+	return c
+}
+
+// Weigher sets the function used to compute the weight of a value when it is stored.
+// This is useful for heap-backed values such as strings, slices and pointers, whose
+// reflected size only covers the header and not the data they reference.
+// If no weigher is set, the size is estimated by following the value's references a few levels deep.
+func (c *Config[K, V]) Weigher(fn func(value V) int) *Config[K, V] {
+	c.weigher = fn
+	return c
+}
+
+// MaxConcurrentScans limits how many full scans (Range, Filter) can run at the same time.
+// Callers exceeding the limit wait until a running scan finishes. Range only holds its slot
+// while it copies the shards, so its callback may start another scan.
+// A count of 0, the default, means scans are not limited.
+func (c *Config[K, V]) MaxConcurrentScans(count int) *Config[K, V] {
+	if count < 0 {
+		return c
+	}
+	c.maxScans = count
+	return c
+}
+
+// Build validates the configuration and returns it, or an error describing the first invalid field.
+// New calls Build and panics if the configuration is invalid.
+func (c *Config[K, V]) Build() (*Config[K, V], error) {
+	switch {
+	case c.shards <= 0 || c.shards&(c.shards-1) != 0:
+		return nil, fmt.Errorf("cache: shards must be a power of 2 greater than 0, got %d", c.shards)
+	case c.maxSize <= 0:
+		return nil, fmt.Errorf("cache: max size must be greater than 0, got %d", c.maxSize)
+	case c.itemsToPrune <= 0:
+		return nil, fmt.Errorf("cache: items to prune must be greater than 0, got %d", c.itemsToPrune)
+	case c.lowWatermark <= 0 || c.lowWatermark > 1:
+		return nil, fmt.Errorf("cache: low watermark must be in (0, 1], got %v", c.lowWatermark)
+	case c.deleteBuffer <= 0:
+		return nil, fmt.Errorf("cache: delete buffer must be greater than 0, got %d", c.deleteBuffer)
+	case c.promoteBuffer <= 0:
+		return nil, fmt.Errorf("cache: promote buffer must be greater than 0, got %d", c.promoteBuffer)
+	case c.getsPerPromote <= 0:
+		return nil, fmt.Errorf("cache: gets per promote must be greater than 0, got %d", c.getsPerPromote)
+	case c.workers <= 0 || c.workers > c.shards:
+		return nil, fmt.Errorf("cache: workers must be between 1 and the number of shards %d, got %d", c.shards, c.workers)
+	case c.promoteTimeout < 0:
+		return nil, fmt.Errorf("cache: promote timeout must not be negative, got %v", c.promoteTimeout)
+	case !validMetricName(c.metricsPrefix):
+		return nil, fmt.Errorf("cache: metrics prefix must be a valid metric name, got %q", c.metricsPrefix)
+	case c.memoizeWeight && reflect.TypeFor[V]().Kind() != reflect.Pointer:
+		return nil, fmt.Errorf("cache: weights can only be memoized for pointer values, got %v", reflect.TypeFor[V]())
+	case c.hashFunc == nil && defaultHash[K]() == nil:
+		return nil, fmt.Errorf("cache: keys of type %v need a HashFunc", reflect.TypeFor[K]())
+	case c.maxKeyLength > 0 && reflect.TypeFor[K]() != reflect.TypeFor[string]():
+		return nil, fmt.Errorf("cache: max key length requires string keys, got %v", reflect.TypeFor[K]())
+	case c.maxKeyLength < 0:
+		return nil, fmt.Errorf("cache: max key length must not be negative, got %d", c.maxKeyLength)
+	case c.digestLongKeys && c.maxKeyLength > 0 && c.maxKeyLength < keyDigestLength:
+		return nil, fmt.Errorf("cache: max key length must be at least %d to digest long keys, got %d", keyDigestLength, c.maxKeyLength)
+	case c.evictionPolicy < LRU || c.evictionPolicy > FIFO:
+		return nil, fmt.Errorf("cache: unknown eviction policy %d", c.evictionPolicy)
+	case c.sampleSize < 0:
+		return nil, fmt.Errorf("cache: sample size must be greater than or equal to 0, got %d", c.sampleSize)
+	case c.maxItemSize < 0:
+		return nil, fmt.Errorf("cache: max item size must be greater than or equal to 0, got %d", c.maxItemSize)
+	case c.maxTTL < 0:
+		return nil, fmt.Errorf("cache: max TTL must not be negative, got %v", c.maxTTL)
+	case c.minTTL < 0 || c.maxTTL > 0 && c.minTTL > c.maxTTL:
+		return nil, fmt.Errorf("cache: min TTL must be between 0 and the max TTL %v, got %v", c.maxTTL, c.minTTL)
+	case c.ttlJitter < 0 || c.ttlJitter >= 1:
+		return nil, fmt.Errorf("cache: TTL jitter must be in [0, 1), got %v", c.ttlJitter)
+	case c.maxScans < 0:
+		return nil, fmt.Errorf("cache: max concurrent scans must not be negative, got %d", c.maxScans)
+	}
+	return c, nil
+}
+
+// OnEvict sets a callback invoked whenever an item leaves the cache: when it is pruned,
+// expired, deleted, cleared, or replaced by Set with a different value. The reason tells these cases apart.
+// Tombstones stored by SetMissing hold no value and never reach the callback.
+// The callback runs on a worker goroutine, or while the workers are paused by Clear, TrimToSize, SetMaxSize,
+// Sync and Close, so it should return quickly and must not block on operations that wait for the workers.
+func (c *Config[K, V]) OnEvict(fn func(key K, value V, reason EvictReason)) *Config[K, V] {
+	c.onEvict = fn
+	return c
+}
+
+// ShardCounters enables per-shard counters of gets, sets and deletes, reported by Cache.ShardStats.
+// They are disabled by default to avoid the extra atomic operations.
+func (c *Config[K, V]) ShardCounters() *Config[K, V] {
+	c.shardCounters = true
+	return c
+}
+
+// MemoizeWeights remembers the weight computed for each distinct pointer value while an item holds it,
+// so that a value stored under many keys is only weighed once. A value is forgotten once the last item
+// holding it leaves the cache, so the memo never keeps evicted values alive.
+// It requires V to be a pointer type, and the values it points to must not change while cached.
+func (c *Config[K, V]) MemoizeWeights() *Config[K, V] {
+	c.memoizeWeight = true
+	return c
+}
+
+// CleanupInterval sets how often the worker removes expired items from the cache.
+// An interval of 0, the default, disables the janitor: expired items then stay
+// until they are pruned by size pressure, deleted or replaced.
+// The janitor is stopped by Cache.Close.
+func (c *Config[K, V]) CleanupInterval(interval time.Duration) *Config[K, V] {
+	if interval < 0 {
+		return c
+	}
+	c.cleanupInterval = interval
+	return c
+}
+
+// ErrorHandler sets a function receiving errors that cannot be returned to the caller,
+// such as an invalid weight computed during Set.
+func (c *Config[K, V]) ErrorHandler(fn func(err error)) *Config[K, V] {
+	c.errorHandler = fn
+	return c
+}
+
+// RejectInvalidWeights makes Set drop values whose weigher panics or returns a negative weight.
+// By default, such weights are clamped to 0 and the value is stored.
+// Either way, the error is reported to the error handler.
+func (c *Config[K, V]) RejectInvalidWeights() *Config[K, V] {
+	c.rejectInvalidWeights = true
+	return c
+}
+
+// GCObserver sets a function called at the end of every garbage collection pass with its statistics.
+// It is useful to tune ItemsToPrune. The observer runs on the worker goroutine and should return quickly.
+func (c *Config[K, V]) GCObserver(fn func(stats GCStats)) *Config[K, V] {
+	c.gcObserver = fn
+	return c
+}
+
+// MaxKeyLength sets the maximum length of a key, in bytes.
+// By default, storing a value under a longer key fails with ErrKeyTooLong, see SetWithResult.
+// With DigestLongKeys, longer keys are replaced by a fixed-length digest instead.
+// A length of 0, the default, means keys are not limited. Only string keys can be limited.
+func (c *Config[K, V]) MaxKeyLength(length int) *Config[K, V] {
+	c.maxKeyLength = length
+	return c
+}
+
+// DigestLongKeys makes the cache replace keys longer than MaxKeyLength by their SHA-256 digest,
+// a 64 character hex string, in every operation instead of rejecting them.
+// Keys reported by Range and Filter are then the digests. MaxKeyLength must be at least 64.
+func (c *Config[K, V]) DigestLongKeys() *Config[K, V] {
+	c.digestLongKeys = true
+	return c
+}
+
+// DefaultTTL sets the duration used by Cache.SetDefault.
+// Without a default TTL, values stored with SetDefault never expire.
+func (c *Config[K, V]) DefaultTTL(ttl time.Duration) *Config[K, V] {
+	c.defaultTTL = ttl
+	return c
+}
+
+// Budget registers the cache with a budget shared with other caches, capping their combined size.
+// The cache still honors its own MaxSize.
+func (c *Config[K, V]) Budget(budget *Budget) *Config[K, V] {
+	c.budget = budget
+	return c
+}
+
+// LoaderOutageWindow makes GetOrSet, and Get with a configured Loader, serve expired items while the loader is failing.
+// After a failed load, expired items are returned without calling the loader again until
+// the window has passed, which keeps a backend outage from turning into a flood of failing loads.
+// A window of 0, the default, disables this behavior.
+func (c *Config[K, V]) LoaderOutageWindow(window time.Duration) *Config[K, V] {
+	if window < 0 {
+		return c
+	}
+	c.loaderOutageWindow = window
+	return c
+}
+
+// EvictionPolicy sets how the cache chooses the items to evict when it grows over its maximum size.
+// The default is LRU.
+func (c *Config[K, V]) EvictionPolicy(p Policy) *Config[K, V] {
+	c.evictionPolicy = p
+	return c
+}
+
+// SampleSize replaces the eviction policy by sampled eviction: to make room, the worker samples n random
+// items across the shards and evicts the one accessed least recently.
+// Get then records accesses on the item itself instead of sending promotions to the worker,
+// which avoids the contention of a single eviction queue under heavy concurrency.
+// Larger samples approximate LRU better. A size of 0, the default, uses the EvictionPolicy.
+func (c *Config[K, V]) SampleSize(n int) *Config[K, V] {
+	c.sampleSize = n
+	return c
+}
+
+// sampled reports whether the configuration replaces the eviction policy by sampled eviction.
+func (c *Config[K, V]) sampled() bool {
+	return c.sampleSize > 0 || c.costFunction != nil
+}
+
+// CostFunction makes eviction weigh more than recency: to make room, the worker samples items like with
+// SampleSize, 16 of them unless a SampleSize is set, and evicts the one for which fn returns the lowest score.
+// A GDSF-like score blends recency and size, so that a large item is evicted before a small one
+// accessed about as recently, for instance:
+//
+//	func(item *Item[K, V]) float64 {
+//		return float64(item.LastAccess().Unix()) - float64(item.Size())/1024
+//	}
+//
+// fn runs on a worker goroutine while it evicts, so it must be fast and must not call back into the cache.
+func (c *Config[K, V]) CostFunction(fn func(item *Item[K, V]) float64) *Config[K, V] {
+	c.costFunction = fn
+	return c
+}
+
+// SlidingTTL makes every hit of Get push the expiration of the item back by the TTL it was stored with,
+// so that items stay cached as long as they are used. Items stored without a TTL are not affected.
+// Each hit then costs an extra atomic write on the item.
+func (c *Config[K, V]) SlidingTTL() *Config[K, V] {
+	c.slidingTTL = true
+	return c
+}
+
+// MaxItemSize sets the maximum weight of a single value, in the same unit as MaxSize.
+// Heavier values are not stored, so that one huge value cannot evict everything else;
+// SetWithResult returns ErrItemTooLarge for them and Stats counts them as rejected.
+// A size of 0, the default, means values are only limited by MaxSize.
+func (c *Config[K, V]) MaxItemSize(n int) *Config[K, V] {
+	c.maxItemSize = n
+	return c
+}
+
+// HashFunc sets the function hashing keys to pick their shard, in place of the default
+// FNV-1a for string keys and bit mixing for integer keys. Other key types require a HashFunc.
+// Only the low bits of the hash are used, as many as needed to index the shards,
+// so they should be well distributed for the keys stored in the cache.
+func (c *Config[K, V]) HashFunc(fn func(key K) uint32) *Config[K, V] {
+	c.hashFunc = fn
+	return c
+}
+
+// MaxTTL caps the duration of every item at d, so that a mistakenly huge TTL cannot pin a value indefinitely.
+// It applies to the writes that take a duration, such as Set, SetNX, SetMulti, Increment and the loaders,
+// and to Extend, GetAndRefresh and SetDeadline. Durations that would never expire are capped too.
+// Replace and CompareAndSwap keep the expiration of the item they update, which was already capped.
+// A duration of 0, the default, sets no cap.
+func (c *Config[K, V]) MaxTTL(d time.Duration) *Config[K, V] {
+	c.maxTTL = d
+	return c
+}
+
+// MinTTL raises the duration of every item stored with a positive duration below d up to d,
+// so that a mistakenly tiny TTL does not expire the value before it is ever read.
+// It applies to the same writes as MaxTTL. A duration of 0 still means the item never expires,
+// and a MinTTL of 0, the default, raises nothing. It cannot exceed a configured MaxTTL.
+func (c *Config[K, V]) MinTTL(d time.Duration) *Config[K, V] {
+	c.minTTL = d
+	return c
+}
+
+// TTLJitter randomizes the expiration of every item stored by Set, SetNX and SetMulti
+// by up to ±fraction of its TTL, so that items loaded together do not all expire at the same instant.
+// The fraction must be in [0, 1). A fraction of 0, the default, disables jitter.
+func (c *Config[K, V]) TTLJitter(fraction float64) *Config[K, V] {
+	c.ttlJitter = fraction
+	return c
+}
+
+// PressureSignal makes the cache shrink on demand, for instance when the program nears a soft memory limit.
+// Each value received on ch is the desired fullness in [0, 1]: the cache is trimmed to that fraction
+// of its max size as if by TrimToSize. Values out of range are clamped. The max size is unchanged,
+// so the cache grows back as values are stored; use SetMaxSize to shrink it durably.
+// The channel is drained by a goroutine of the cache until it is closed or the cache is closed,
+// so a sender should not block on it after closing the cache.
+func (c *Config[K, V]) PressureSignal(ch <-chan float64) *Config[K, V] {
+	c.pressure = ch
+	return c
+}
+
+// Loader makes the cache read-through: Get calls fn for missing or expired keys and stores
+// the value it returns with the returned TTL. Concurrent Gets for the same key share a single call.
+// Loader errors are passed to the error handler. Note that Get then blocks while a key is loaded.
+func (c *Config[K, V]) Loader(fn func(key K) (V, time.Duration, error)) *Config[K, V] {
+	c.loader = fn
+	return c
+}
+
+// StaleWhileRevalidate keeps Get from blocking on the Loader for items that expired less than grace ago:
+// Get returns the expired item right away and reloads the key in the background, once however many Gets
+// hit it meanwhile. Later Gets return the fresh value once it is loaded. If the reload fails, the error
+// goes to the error handler and the next Get within the grace period tries again. Items expired for longer
+// are loaded synchronously as usual. A grace of 0, the default, disables this behavior.
+func (c *Config[K, V]) StaleWhileRevalidate(grace time.Duration) *Config[K, V] {
+	if grace < 0 {
 		return c
 	}
-	c.freeListSize = size
+	c.staleGrace = grace
 	return c
 }
@@ -0,0 +1,104 @@
+package cache_test
+
+import (
+	"runtime"
+	"testing"
+	"time"
+
+	"github.com/mcheviron/cache"
+)
+
+func TestConfigBuild(t *testing.T) {
+	if _, err := cache.NewConfig[string, string]().Build(); err != nil {
+		t.Errorf("Expected default config to be valid, got %v", err)
+	}
+
+	invalid := map[string]*cache.Config[string, string]{
+		"max size":         cache.NewConfig[string, string]().MaxSize(0),
+		"items to prune":   cache.NewConfig[string, string]().ItemsToPrune(0),
+		"delete buffer":    cache.NewConfig[string, string]().DeleteBuffer(0),
+		"promote buffer":   cache.NewConfig[string, string]().PromoteBuffer(0),
+		"eviction policy":  cache.NewConfig[string, string]().EvictionPolicy(cache.Policy(-1)),
+		"sample size":      cache.NewConfig[string, string]().SampleSize(-1),
+		"max item size":    cache.NewConfig[string, string]().MaxItemSize(-1),
+		"TTL jitter":       cache.NewConfig[string, string]().TTLJitter(1),
+		"no workers":       cache.NewConfig[string, string]().Workers(0),
+		"gets per promote": cache.NewConfig[string, string]().GetsPerPromote(0),
+		"low watermark":    cache.NewConfig[string, string]().LowWatermark(1.5),
+		"metrics prefix":   cache.NewConfig[string, string]().MetricsPrefix("my-cache"),
+		"max TTL":          cache.NewConfig[string, string]().MaxTTL(-time.Second),
+		"min TTL":          cache.NewConfig[string, string]().MinTTL(-time.Second),
+		"min over max TTL": cache.NewConfig[string, string]().MaxTTL(time.Second).MinTTL(time.Minute),
+		"too many workers": cache.NewConfig[string, string]().Shards(4).Workers(8),
+		"zero value":       &cache.Config[string, string]{},
+	}
+	for name, config := range invalid {
+		if _, err := config.Build(); err == nil {
+			t.Errorf("Expected %s config to be invalid", name)
+		}
+	}
+}
+
+func TestNewPanicsOnInvalidConfig(t *testing.T) {
+	defer func() {
+		if recover() == nil {
+			t.Errorf("Expected New to panic on an invalid config")
+		}
+	}()
+
+	cache.New(cache.NewConfig[string, string]().MaxSize(0))
+}
+
+func TestConfigBuildMemoizeWeightsRequiresPointer(t *testing.T) {
+	if _, err := cache.NewConfig[string, string]().MemoizeWeights().Build(); err == nil {
+		t.Errorf("Expected memoizing weights of non-pointer values to be invalid")
+	}
+
+	if _, err := cache.NewConfig[string, *string]().MemoizeWeights().Build(); err != nil {
+		t.Errorf("Expected memoizing weights of pointer values to be valid, got %v", err)
+	}
+}
+
+func TestConfigBuildDigestLongKeysRequiresRoom(t *testing.T) {
+	if _, err := cache.NewConfig[string, string]().MaxKeyLength(32).DigestLongKeys().Build(); err == nil {
+		t.Errorf("Expected a max key length shorter than the digest to be invalid")
+	}
+}
+
+func TestConfigAutoShards(t *testing.T) {
+	expected := 4
+	for expected < runtime.GOMAXPROCS(0) && expected < 256 {
+		expected *= 2
+	}
+
+	if n := len(cache.New(cache.NewConfig[string, string]().AutoShards()).ShardStats()); n != expected {
+		t.Errorf("Expected %d shards, got %d", expected, n)
+	}
+
+	if n := len(cache.New(cache.NewConfig[string, string]().Shards(2).AutoShards()).ShardStats()); n != 2 {
+		t.Errorf("Expected explicit shards set before AutoShards to take precedence, got %d", n)
+	}
+	if n := len(cache.New(cache.NewConfig[string, string]().AutoShards().Shards(2)).ShardStats()); n != 2 {
+		t.Errorf("Expected explicit shards set after AutoShards to take precedence, got %d", n)
+	}
+}
+
+func TestConfigBuildKeyTypes(t *testing.T) {
+	type userResource struct {
+		user, resource int
+	}
+
+	if _, err := cache.NewConfig[int, string]().Build(); err != nil {
+		t.Errorf("Expected integer keys to have a default hash, got %v", err)
+	}
+	if _, err := cache.NewConfig[userResource, string]().Build(); err == nil {
+		t.Errorf("Expected struct keys without a hash function to be invalid")
+	}
+	hash := func(key userResource) uint32 { return uint32(key.user ^ key.resource) }
+	if _, err := cache.NewConfig[userResource, string]().HashFunc(hash).Build(); err != nil {
+		t.Errorf("Expected struct keys with a hash function to be valid, got %v", err)
+	}
+	if _, err := cache.NewConfig[int, string]().MaxKeyLength(10).Build(); err == nil {
+		t.Errorf("Expected a max key length on integer keys to be invalid")
+	}
+}
@@ -0,0 +1,55 @@
+package cache
+
+import (
+	"sync/atomic"
+	"time"
+)
+
+// Number is the set of types that can be used as counters with Increment and Decrement.
+type Number interface {
+	~int | ~int8 | ~int16 | ~int32 | ~int64 |
+		~uint | ~uint8 | ~uint16 | ~uint32 | ~uint64 | ~uintptr |
+		~float32 | ~float64
+}
+
+// Increment atomically adds delta to the value stored for the key and returns the new value.
+// A present, non-expired counter keeps its expiration; an absent or expired counter, or a tombstone
+// stored by SetMissing, is reset to delta and expires after ttl.
+func Increment[K comparable, V Number](c *Cache[K, V], key K, delta V, ttl time.Duration) V {
+	c.writes.RLock()
+	defer c.writes.RUnlock()
+	key = c.normalizeKey(key)
+	ttl = c.clampTTL(ttl)
+	var current V
+	item, old := c.getShard(key).update(key, func(existing *Item[K, V]) *Item[K, V] {
+		value := delta
+		expires := expiresAt(c.clock, ttl)
+		duration := ttl
+		if existing != nil && !existing.Expired() && !existing.missing {
+			current = existing.value
+			value = existing.value + delta
+			expires = atomic.LoadInt64(&existing.expires)
+			duration = existing.ttl
+		}
+		item, err := c.newItem(key, value, expires)
+		if err != nil {
+			return nil
+		}
+		item.ttl = duration
+		return item
+	})
+	if item == nil {
+		return current
+	}
+	if old != nil {
+		c.discard(deletion[K, V]{item: old, notify: c.replaceNotifies(old, item.value), reason: Replaced})
+	}
+	c.promote(promotion[K, V]{item: item})
+	return item.value
+}
+
+// Decrement atomically subtracts delta from the value stored for the key and returns the new value.
+// It follows the same expiration rules as Increment.
+func Decrement[K comparable, V Number](c *Cache[K, V], key K, delta V, ttl time.Duration) V {
+	return Increment(c, key, -delta, ttl)
+}
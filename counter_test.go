@@ -0,0 +1,66 @@
+package cache_test
+
+import (
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/mcheviron/cache"
+)
+
+func TestIncrement(t *testing.T) {
+	c := cache.New(cache.NewConfig[string, int64]())
+
+	if n := cache.Increment(c, "key1", 5, time.Second); n != 5 {
+		t.Errorf("Expected counter to start at 5, got %d", n)
+	}
+
+	if n := cache.Increment(c, "key1", 2, time.Second); n != 7 {
+		t.Errorf("Expected counter to be 7, got %d", n)
+	}
+
+	if n := cache.Decrement(c, "key1", 3, time.Second); n != 4 {
+		t.Errorf("Expected counter to be 4, got %d", n)
+	}
+}
+
+func TestIncrementConcurrent(t *testing.T) {
+	c := cache.New(cache.NewConfig[string, int64]())
+
+	var wg sync.WaitGroup
+	for range 100 {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			cache.Increment(c, "key1", 1, time.Minute)
+		}()
+	}
+	wg.Wait()
+
+	if item := c.Get("key1"); item == nil || item.Value() != 100 {
+		t.Errorf("Expected counter to be 100 after concurrent increments")
+	}
+}
+
+func TestIncrementExpiredCounter(t *testing.T) {
+	c := cache.New(cache.NewConfig[string, int64]())
+
+	cache.Increment(c, "key1", 10, time.Nanosecond)
+	time.Sleep(time.Millisecond)
+
+	if n := cache.Increment(c, "key1", 3, time.Second); n != 3 {
+		t.Errorf("Expected expired counter to reset to 3, got %d", n)
+	}
+}
+
+func TestIncrementTombstone(t *testing.T) {
+	c := cache.New(cache.NewConfig[string, int64]())
+	c.SetMissing("key1", time.Second)
+
+	if n := cache.Increment(c, "key1", 3, time.Hour); n != 3 {
+		t.Errorf("Expected counter to start at 3 over a tombstone, got %d", n)
+	}
+	if item := c.Get("key1"); item == nil || item.TTL() < time.Hour-time.Minute {
+		t.Errorf("Expected the counter to expire after the requested TTL instead of the tombstone's")
+	}
+}
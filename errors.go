@@ -0,0 +1,18 @@
+package cache
+
+import "errors"
+
+var (
+	// ErrInvalidWeight is reported when a weigher panics or returns a negative weight.
+	ErrInvalidWeight = errors.New("cache: invalid weight")
+	// ErrKeyTooLong is returned when a key exceeds the configured maximum key length.
+	ErrKeyTooLong = errors.New("cache: key too long")
+	// ErrItemTooLarge is returned when the weight of a value exceeds the configured maximum item size.
+	ErrItemTooLarge = errors.New("cache: item too large")
+	// ErrCacheFull is returned when a value weighs more than the cache can hold, so no eviction can make room for it.
+	ErrCacheFull = errors.New("cache: cache full")
+	// ErrNotFound is returned by GetOrSet for keys stored as missing with SetMissing, until the tombstone expires.
+	ErrNotFound = errors.New("cache: not found")
+	// ErrClosed is returned for values written once Close or DrainAndClose has been called.
+	ErrClosed = errors.New("cache: closed")
+)
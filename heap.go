@@ -0,0 +1,30 @@
+package cache
+
+// itemHeap is a heap of items whose root is the last item in the order defined by less.
+// It is used to keep the first n items of a scan without sorting all of them.
+type itemHeap[K comparable, V any] struct {
+	items []*Item[K, V]
+	less  func(a, b *Item[K, V]) bool
+}
+
+func (h *itemHeap[K, V]) Len() int {
+	return len(h.items)
+}
+
+func (h *itemHeap[K, V]) Less(i, j int) bool {
+	return h.less(h.items[j], h.items[i])
+}
+
+func (h *itemHeap[K, V]) Swap(i, j int) {
+	h.items[i], h.items[j] = h.items[j], h.items[i]
+}
+
+func (h *itemHeap[K, V]) Push(x any) {
+	h.items = append(h.items, x.(*Item[K, V]))
+}
+
+func (h *itemHeap[K, V]) Pop() any {
+	item := h.items[len(h.items)-1]
+	h.items = h.items[:len(h.items)-1]
+	return item
+}
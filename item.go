@@ -1,59 +1,165 @@
 package cache
 
 import (
-	"reflect"
+	"math"
 	"sync/atomic"
 	"time"
 )
 
-type Item[T any] struct {
-	value      T
-	key        string
-	node       *node[*Item[T]]
+type Item[K comparable, V any] struct {
+	value      V
+	key        K
+	node       *node[*Item[K, V]]
 	expires    int64
+	stale      int64
 	size       int
 	promotions int32
+	tracked    bool
+	index      int
+	hits       uint32
+	tick       uint64
+	accessed   int64
+	ttl        time.Duration
+	missing    bool
+	memoized   bool
+	onExpire   func(key K, value V)
+	copier     func(value V) V
+	clock      Clock
 }
 
-func newItem[T any](key string, value T, expires int64) *Item[T] {
-	return &Item[T]{
+// NoExpiration is the TTL reported for items that never expire.
+const NoExpiration = time.Duration(math.MaxInt64)
+
+// noExpiration is the expiration time stored for items that never expire.
+const noExpiration = 0
+
+// expiresAt returns the expiration time of an item stored for the given duration according to the clock.
+// A non-positive duration, or one too long to be represented, means the item never expires.
+func expiresAt(clock Clock, duration time.Duration) int64 {
+	if duration <= 0 {
+		return noExpiration
+	}
+	now := now(clock)
+	if int64(duration) > math.MaxInt64-now {
+		return noExpiration
+	}
+	return now + int64(duration)
+}
+
+func newItem[K comparable, V any](key K, value V, expires int64, size int) *Item[K, V] {
+	return &Item[K, V]{
 		key:     key,
 		value:   value,
 		expires: expires,
-		size:    int(reflect.TypeOf(value).Size()),
+		size:    size,
+	}
+}
+
+// weigh computes the weight of a value using the weigher if present,
+// falling back to an estimate of the bytes used by the value.
+func weigh[V any](value V, weigher func(value V) int) int {
+	if weigher != nil {
+		return weigher(value)
 	}
+	return estimateSize(value)
 }
 
-func (i *Item[T]) Value() T {
+func (i *Item[K, V]) Value() V {
 	return i.value
 }
 
-func (i *Item[T]) Key() string {
+// ValueCopy returns a copy of the value made by the configured Copier, so that callers can modify it
+// without changing the value shared through the cache. How deep the copy goes is up to the copier.
+// Without a copier it returns the value like Value: a shallow copy, whose slices, maps and pointers
+// still reference the cached data.
+func (i *Item[K, V]) ValueCopy() V {
+	if i.copier == nil || i.missing {
+		return i.value
+	}
+	return i.copier(i.value)
+}
+
+func (i *Item[K, V]) Key() K {
 	return i.key
 }
 
-func (i *Item[T]) Extend(duration time.Duration) {
-	atomic.StoreInt64(&i.expires, time.Now().Add(duration).UnixNano())
+// Missing reports whether the item is a tombstone stored by SetMissing, holding the zero value.
+func (i *Item[K, V]) Missing() bool {
+	return i.missing
+}
+
+// Size returns the weight the item accounts for in the cache.
+func (i *Item[K, V]) Size() int {
+	return i.size
+}
+
+func (i *Item[K, V]) Extend(duration time.Duration) {
+	atomic.StoreInt64(&i.expires, expiresAt(i.clock, duration))
+}
+
+// SetDeadline makes the item expire at t, or never for the zero time.
+func (i *Item[K, V]) SetDeadline(t time.Time) {
+	expires := int64(noExpiration)
+	if !t.IsZero() {
+		expires = t.UnixNano()
+	}
+	atomic.StoreInt64(&i.expires, expires)
 }
 
-func (i *Item[T]) Expired() bool {
+// slide pushes the expiration of an item stored with a TTL back by that TTL.
+func (i *Item[K, V]) slide() {
+	if i.ttl > 0 {
+		atomic.StoreInt64(&i.expires, expiresAt(i.clock, i.ttl))
+	}
+}
+
+func (i *Item[K, V]) Expired() bool {
+	return i.expiredAt(now(i.clock))
+}
+
+// expiredAt reports whether the item is expired at t, in nanoseconds since the epoch,
+// for callers checking many items against a single reading of the clock.
+func (i *Item[K, V]) expiredAt(t int64) bool {
 	expires := atomic.LoadInt64(&i.expires) // this field is acccessed concurrently
-	return expires < time.Now().UnixNano()
+	return expires != noExpiration && expires < t
 }
 
-func (i *Item[T]) TTL() time.Duration {
-	expires := atomic.LoadInt64(&i.expires)
-	return time.Nanosecond * time.Duration(expires-time.Now().UnixNano())
+// Stale reports whether the item is past its soft TTL and should be refreshed.
+// Items stored without a soft TTL are never stale.
+func (i *Item[K, V]) Stale() bool {
+	stale := atomic.LoadInt64(&i.stale)
+	return stale != noExpiration && stale < now(i.clock)
 }
 
-func (i *Item[T]) shouldPromote(getsPerPromote int32) bool {
-	i.promotions++
-	return i.promotions == getsPerPromote
+// access records that the item is being used now, for LastAccess and sampled eviction.
+func (i *Item[K, V]) access() {
+	i.accessAt(now(i.clock))
+}
+
+// accessAt records that the item was used at t, in nanoseconds since the epoch.
+func (i *Item[K, V]) accessAt(t int64) {
+	atomic.StoreInt64(&i.accessed, t)
 }
 
-func (i *Item[T]) reset(key string, value T, expires int64) {
-	i.promotions = 0
-	i.key = key
-	i.value = value
-	i.expires = expires
+// LastAccess returns when a Get or GetMulti last hit the item, or the zero time if none did.
+// With sampled eviction, the worker also records an access when it starts tracking the item.
+func (i *Item[K, V]) LastAccess() time.Time {
+	accessed := atomic.LoadInt64(&i.accessed)
+	if accessed == 0 {
+		return time.Time{}
+	}
+	return time.Unix(0, accessed)
+}
+
+func (i *Item[K, V]) TTL() time.Duration {
+	expires := atomic.LoadInt64(&i.expires)
+	if expires == noExpiration {
+		return NoExpiration
+	}
+	return time.Nanosecond * time.Duration(expires-now(i.clock))
+}
+
+func (i *Item[K, V]) shouldPromote(getsPerPromote int32) bool {
+	i.promotions++
+	return i.promotions >= getsPerPromote
 }
@@ -8,7 +8,7 @@ import (
 func TestNewItem(t *testing.T) {
 	// Test case 1: Integer value
 	intValue := 42
-	item1 := newItem("key", intValue, 0)
+	item1 := newItem("key", intValue, 0, weigh(intValue, nil))
 	expectedSize1 := int(reflect.TypeOf(intValue).Size())
 
 	if item1.size != expectedSize1 {
@@ -21,11 +21,83 @@ func TestNewItem(t *testing.T) {
 		Number int
 	}
 	structValue := myStruct{Name: "John", Number: 123}
-	item2 := newItem("key", structValue, 0)
-	expectedSize2 := int(reflect.TypeOf(structValue).Size())
+	item2 := newItem("key", structValue, 0, weigh(structValue, nil))
+	expectedSize2 := int(reflect.TypeOf(structValue).Size()) + len(structValue.Name)
 	println(expectedSize2)
 
 	if item2.size != expectedSize2 {
 		t.Errorf("Expected item size to be %d, got %d", expectedSize2, item2.size)
 	}
 }
+
+func TestNewItemReferenceTypes(t *testing.T) {
+	// Test case 1: String value
+	stringValue := "hello world"
+	item1 := newItem("key", stringValue, 0, weigh(stringValue, nil))
+	expectedSize1 := int(reflect.TypeOf(stringValue).Size()) + len(stringValue)
+
+	if item1.size != expectedSize1 {
+		t.Errorf("Expected item size to be %d, got %d", expectedSize1, item1.size)
+	}
+
+	// Test case 2: Byte slice value
+	bytesValue := make([]byte, 1000)
+	item2 := newItem("key", bytesValue, 0, weigh(bytesValue, nil))
+	expectedSize2 := int(reflect.TypeOf(bytesValue).Size()) + len(bytesValue)
+
+	if item2.size != expectedSize2 {
+		t.Errorf("Expected item size to be %d, got %d", expectedSize2, item2.size)
+	}
+
+	// Test case 3: Map of strings
+	mapValue := map[string]string{"a": "bc"}
+	item3 := newItem("key", mapValue, 0, weigh(mapValue, nil))
+	expectedSize3 := int(reflect.TypeOf(mapValue).Size()) + 2*int(reflect.TypeOf("").Size()) + 3
+
+	if item3.size != expectedSize3 {
+		t.Errorf("Expected item size to be %d, got %d", expectedSize3, item3.size)
+	}
+}
+
+func TestEstimateSizeSampled(t *testing.T) {
+	strings := make([]string, 1000)
+	for i := range strings {
+		strings[i] = "0123456789"
+	}
+	expected := int(reflect.TypeOf(strings).Size()) + 1000*int(reflect.TypeOf("").Size()) + 1000*10
+	if size := estimateSize(strings); size != expected {
+		t.Errorf("Expected the size of uniform strings to be extrapolated to %d, got %d", expected, size)
+	}
+
+	ints := make(map[int]string, 1000)
+	for i := range 1000 {
+		ints[i] = "abcd"
+	}
+	expected = int(reflect.TypeOf(ints).Size()) + 1000*int(reflect.TypeOf(0).Size()+reflect.TypeOf("").Size()) + 1000*4
+	if size := estimateSize(ints); size != expected {
+		t.Errorf("Expected the size of uniform map entries to be extrapolated to %d, got %d", expected, size)
+	}
+
+	type point struct{ X, Y float64 }
+	points := make([]point, 1<<16)
+	expected = int(reflect.TypeOf(points).Size()) + len(points)*int(reflect.TypeOf(point{}).Size())
+	if size := estimateSize(points); size != expected {
+		t.Errorf("Expected the size of a slice without references to be %d, got %d", expected, size)
+	}
+}
+
+func BenchmarkEstimateSizeBytes(b *testing.B) {
+	value := make([]byte, 1<<20)
+	for range b.N {
+		estimateSize(value)
+	}
+}
+
+func TestNewItemWithWeigher(t *testing.T) {
+	value := make([]byte, 1000)
+	item := newItem("key", value, 0, weigh(value, func(v []byte) int { return len(v) }))
+
+	if item.size != 1000 {
+		t.Errorf("Expected item size to be 1000, got %d", item.size)
+	}
+}
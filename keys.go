@@ -0,0 +1,72 @@
+package cache
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"reflect"
+)
+
+// keyDigestLength is the length of the digest replacing long keys.
+const keyDigestLength = 2 * sha256.Size
+
+// normalizeKey returns the key under which the cache stores values for key.
+// It is the key itself unless long keys are replaced by their digest.
+// Digests are never longer than the maximum key length, so normalizing twice is harmless.
+// Only string keys can be limited, which Config.Build enforces.
+func (c *Cache[K, V]) normalizeKey(key K) K {
+	if !c.digestLongKeys || c.maxKeyLength == 0 {
+		return key
+	}
+	s, ok := any(key).(string)
+	if !ok || len(s) <= c.maxKeyLength {
+		return key
+	}
+	sum := sha256.Sum256([]byte(s))
+	return any(hex.EncodeToString(sum[:])).(K)
+}
+
+// checkKey returns ErrKeyTooLong if the key exceeds the maximum key length.
+func (c *Cache[K, V]) checkKey(key K) error {
+	if c.maxKeyLength == 0 {
+		return nil
+	}
+	if s, ok := any(key).(string); ok && len(s) > c.maxKeyLength {
+		return ErrKeyTooLong
+	}
+	return nil
+}
+
+// keyString returns the key as a string, formatting keys that are not strings with fmt.Sprint.
+func keyString[K comparable](key K) string {
+	if s, ok := any(key).(string); ok {
+		return s
+	}
+	return fmt.Sprint(key)
+}
+
+// defaultHash returns the hash picking the shard of keys of type K when no HashFunc is configured:
+// FNV-1a for strings and a bit mixer for integers. It switches on the kind of K, so that named
+// string and integer types hash like their underlying type. Other key types have no default hash and return nil.
+func defaultHash[K comparable]() func(key K) uint32 {
+	switch reflect.TypeFor[K]().Kind() {
+	case reflect.String:
+		return func(key K) uint32 { return fnv32a(reflect.ValueOf(key).String()) }
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return func(key K) uint32 { return mixBits(uint64(reflect.ValueOf(key).Int())) }
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+		return func(key K) uint32 { return mixBits(reflect.ValueOf(key).Uint()) }
+	default:
+		return nil
+	}
+}
+
+// mixBits hashes an integer key, mixing its bits so that consecutive keys spread over all the shards.
+func mixBits(x uint64) uint32 {
+	x ^= x >> 33
+	x *= 0xff51afd7ed558ccd
+	x ^= x >> 33
+	x *= 0xc4ceb9fe1a85ec53
+	x ^= x >> 33
+	return uint32(x)
+}
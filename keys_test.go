@@ -0,0 +1,58 @@
+package cache_test
+
+import (
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/mcheviron/cache"
+)
+
+func TestCacheMaxKeyLengthRejects(t *testing.T) {
+	c := cache.New(cache.NewConfig[string, string]().MaxKeyLength(8))
+	long := strings.Repeat("k", 9)
+
+	if err := c.SetWithResult(long, "value1", time.Second); !errors.Is(err, cache.ErrKeyTooLong) {
+		t.Errorf("Expected error to be %v, got %v", cache.ErrKeyTooLong, err)
+	}
+
+	c.Set(long, "value1", time.Second)
+
+	if c.Get(long) != nil {
+		t.Errorf("Expected over-long key to not be stored")
+	}
+
+	if err := c.SetWithResult("key1", "value1", time.Second); err != nil {
+		t.Errorf("Expected no error for a short key, got %v", err)
+	}
+}
+
+func TestCacheMaxKeyLengthDigests(t *testing.T) {
+	c := cache.New(cache.NewConfig[string, string]().MaxKeyLength(64).DigestLongKeys())
+	long := strings.Repeat("k", 100)
+
+	if err := c.SetWithResult(long, "value1", time.Second); err != nil {
+		t.Fatalf("Expected no error when digesting long keys, got %v", err)
+	}
+
+	item := c.Get(long)
+
+	if item == nil || item.Value() != "value1" {
+		t.Fatalf("Expected Get to find the value stored under a digested key")
+	}
+
+	if len(item.Key()) != 64 {
+		t.Errorf("Expected stored key to be a 64 character digest, got %d characters", len(item.Key()))
+	}
+
+	if !c.Extend(long, time.Minute) {
+		t.Errorf("Expected Extend to find the digested key")
+	}
+
+	c.Delete(long)
+
+	if c.Get(long) != nil {
+		t.Errorf("Expected Delete to remove the digested key")
+	}
+}
@@ -0,0 +1,250 @@
+package cache
+
+import (
+	"context"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// call is an in-flight or completed load for a key.
+type call[K comparable, V any] struct {
+	done     chan struct{}
+	item     *Item[K, V]
+	err      error
+	panicked any
+}
+
+// result returns the result of a completed call, panicking again with the value the load panicked with, if any.
+func (c *call[K, V]) result() (*Item[K, V], error) {
+	if c.panicked != nil {
+		panic(c.panicked)
+	}
+	return c.item, c.err
+}
+
+// group deduplicates concurrent loads for the same key so that only one runs at a time.
+type group[K comparable, V any] struct {
+	mu    sync.Mutex
+	calls map[K]*call[K, V]
+}
+
+// do starts fn for the key in its own goroutine unless a load for it is already in flight,
+// and waits for the load to return its result. A caller whose context is done stops waiting
+// and returns the context error, including the one that started the load,
+// leaving the load to complete for the other callers.
+// If fn panics, every caller still waiting panics with the same value,
+// and the next call for the key starts a new load.
+func (g *group[K, V]) do(ctx context.Context, key K, fn func() (*Item[K, V], error)) (*Item[K, V], error) {
+	g.mu.Lock()
+	if g.calls == nil {
+		g.calls = make(map[K]*call[K, V])
+	}
+	c, ok := g.calls[key]
+	if !ok {
+		c = &call[K, V]{done: make(chan struct{})}
+		g.calls[key] = c
+		go g.run(key, c, fn)
+	}
+	g.mu.Unlock()
+
+	select {
+	case <-c.done:
+		return c.result()
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+}
+
+// run calls fn for the call and completes it, recording the value fn panicked with instead of its result, if any.
+func (g *group[K, V]) run(key K, c *call[K, V], fn func() (*Item[K, V], error)) {
+	defer func() {
+		if r := recover(); r != nil {
+			c.panicked = r
+		}
+		g.mu.Lock()
+		delete(g.calls, key)
+		g.mu.Unlock()
+		close(c.done)
+	}()
+	c.item, c.err = fn()
+}
+
+// GetOrSet returns the item for the key if it is present and not expired.
+// Otherwise it calls loader, stores the value with the given ttl and returns the new item.
+// Concurrent callers for the same key wait for a single in-flight load instead of calling loader themselves.
+// A loader error is returned to every waiting caller and nothing is stored.
+// For a key stored as missing with SetMissing, GetOrSet returns ErrNotFound without calling loader
+// until the tombstone expires.
+//
+// With a configured LoaderOutageWindow, a loader failure starts an outage: until the window has passed
+// without another failure, expired items are returned as they are instead of being loaded again,
+// and a failing load returns the expired item, if any, instead of the error.
+func (c *Cache[K, V]) GetOrSet(key K, ttl time.Duration, loader func() (V, error)) (*Item[K, V], error) {
+	return c.GetOrSetContext(context.Background(), key, ttl, func(context.Context) (V, error) {
+		return loader()
+	})
+}
+
+// GetOrSetContext is like GetOrSet, but passes ctx to the loader. Every caller, including the one
+// whose call started the load, returns ctx.Err() as soon as its ctx is done; the load itself goes on
+// in the background and its result is still stored and returned to the other callers.
+// Since the load is shared, the loader receives context.WithoutCancel of the ctx of the caller that started it:
+// it carries the values of that ctx, but neither its deadline nor its cancellation.
+func (c *Cache[K, V]) GetOrSetContext(ctx context.Context, key K, ttl time.Duration, loader func(context.Context) (V, error)) (*Item[K, V], error) {
+	key = c.normalizeKey(key)
+	item := c.get(key)
+	if item != nil && item.missing {
+		if !item.Expired() {
+			return nil, ErrNotFound
+		}
+		item = nil
+	}
+	if item != nil && (!item.Expired() || c.loaderOutage()) {
+		return item, nil
+	}
+	return c.loads.do(ctx, key, func() (*Item[K, V], error) {
+		item := c.getShard(key).get(key)
+		if item != nil && !item.Expired() {
+			if item.missing {
+				return nil, ErrNotFound
+			}
+			return item, nil
+		}
+		if item != nil && item.missing {
+			item = nil
+		}
+		value, err := loader(context.WithoutCancel(ctx))
+		if err != nil {
+			if c.loaderOutageWindow > 0 {
+				c.lastLoadFailure.Store(now(c.clock))
+				if item != nil {
+					return item, nil
+				}
+			}
+			return nil, err
+		}
+		c.lastLoadFailure.Store(0)
+		return c.set(key, value, ttl)
+	})
+}
+
+// GetOrSetMulti returns the items for the keys that are present and not expired, and loads the others
+// with a single call to loader, storing the values it returns with the given ttl.
+// loader is only called if some keys are missing, with each of them once; keys it leaves out of its result
+// are neither stored nor returned. Keys stored as missing with SetMissing are left out of the result
+// without being loaded until their tombstone expires. A loader error is returned along with the items
+// found in the cache, and nothing is stored. Unlike GetOrSet, concurrent calls are not deduplicated,
+// so the same keys may be loaded by several callers at once.
+func (c *Cache[K, V]) GetOrSetMulti(keys []K, ttl time.Duration, loader func(missing []K) (map[K]V, error)) (map[K]*Item[K, V], error) {
+	result := make(map[K]*Item[K, V], len(keys))
+	var missing []K
+	seen := make(map[K]struct{})
+	c.getMany(keys, func(key K, item *Item[K, V]) {
+		if item != nil && !item.Expired() {
+			if item.missing {
+				c.stats.misses.Add(1)
+				return
+			}
+			c.stats.hits.Add(1)
+			result[key] = item
+			item.access()
+			c.tryPromote(item)
+			return
+		}
+		c.stats.misses.Add(1)
+		if _, ok := seen[key]; !ok {
+			seen[key] = struct{}{}
+			missing = append(missing, key)
+		}
+	})
+	if len(missing) == 0 {
+		return result, nil
+	}
+
+	values, err := loader(missing)
+	if err != nil {
+		return result, err
+	}
+	for _, key := range missing {
+		value, ok := values[key]
+		if !ok {
+			continue
+		}
+		if item, err := c.set(key, value, ttl); err == nil {
+			result[key] = item
+		}
+	}
+	return result, nil
+}
+
+// loaderOutage reports whether a load has failed within the configured outage window.
+func (c *Cache[K, V]) loaderOutage() bool {
+	failed := c.lastLoadFailure.Load()
+	return failed != 0 && time.Duration(now(c.clock)-failed) < c.loaderOutageWindow
+}
+
+// inGrace reports whether an expired item expired less than the StaleWhileRevalidate grace ago.
+func (c *Cache[K, V]) inGrace(item *Item[K, V]) bool {
+	expires := atomic.LoadInt64(&item.expires)
+	return c.staleGrace > 0 && expires != noExpiration && now(c.clock)-expires <= int64(c.staleGrace)
+}
+
+// revalidate reloads a key in the background, unless it is already being reloaded, the cache is closed
+// or the loader is failing within the configured outage window. Close waits for the reload to finish.
+func (c *Cache[K, V]) revalidate(key K) {
+	if c.loaderOutage() {
+		return
+	}
+	select {
+	case <-c.done:
+		return
+	default:
+	}
+	if _, running := c.revalidating.LoadOrStore(key, struct{}{}); running {
+		return
+	}
+	c.running.Add(1)
+	go func() {
+		defer c.running.Done()
+		defer c.revalidating.Delete(key)
+		select {
+		case <-c.done:
+		default:
+			c.load(key, nil)
+		}
+	}()
+}
+
+// load calls the configured loader for a missing or expired key and stores its result,
+// returning the item found before the load if it fails. Like with GetOrSet, an expired item
+// is returned as it is while the loader is failing within the configured outage window.
+func (c *Cache[K, V]) load(key K, found *Item[K, V]) *Item[K, V] {
+	if found != nil && c.loaderOutage() {
+		return found
+	}
+	item, err := c.loads.do(context.Background(), key, func() (*Item[K, V], error) {
+		item := c.getShard(key).get(key)
+		if item != nil && !item.Expired() {
+			if item.missing {
+				return nil, nil
+			}
+			return item, nil
+		}
+		value, ttl, err := c.loader(key)
+		if err != nil {
+			if c.loaderOutageWindow > 0 {
+				c.lastLoadFailure.Store(now(c.clock))
+			}
+			return nil, err
+		}
+		c.lastLoadFailure.Store(0)
+		c.stats.loads.Add(1)
+		return c.set(key, value, ttl)
+	})
+	if err != nil {
+		c.reportError(err)
+		return found
+	}
+	return item
+}
@@ -0,0 +1,655 @@
+package cache_test
+
+import (
+	"context"
+	"errors"
+	"slices"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/mcheviron/cache"
+)
+
+func TestCacheGetOrSet(t *testing.T) {
+	cache := cache.New(cache.NewConfig[string, string]())
+
+	var calls atomic.Int32
+	loader := func() (string, error) {
+		calls.Add(1)
+		time.Sleep(10 * time.Millisecond)
+		return "value1", nil
+	}
+
+	var wg sync.WaitGroup
+	for range 10 {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			item, err := cache.GetOrSet("key1", time.Second, loader)
+			if err != nil {
+				t.Errorf("Expected no error, got %v", err)
+				return
+			}
+			if item.Value() != "value1" {
+				t.Errorf("Expected item value to be 'value1', got '%s'", item.Value())
+			}
+		}()
+	}
+	wg.Wait()
+
+	if n := calls.Load(); n != 1 {
+		t.Errorf("Expected loader to be called once, got %d", n)
+	}
+
+	if item := cache.Get("key1"); item == nil || item.Value() != "value1" {
+		t.Errorf("Expected loaded value to be stored")
+	}
+}
+
+func TestCacheGetOrSetError(t *testing.T) {
+	cache := cache.New(cache.NewConfig[string, string]())
+	errLoad := errors.New("load failed")
+
+	var wg sync.WaitGroup
+	for range 5 {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			_, err := cache.GetOrSet("key1", time.Second, func() (string, error) {
+				time.Sleep(10 * time.Millisecond)
+				return "", errLoad
+			})
+			if !errors.Is(err, errLoad) {
+				t.Errorf("Expected error to be %v, got %v", errLoad, err)
+			}
+		}()
+	}
+	wg.Wait()
+
+	if item := cache.Get("key1"); item != nil {
+		t.Errorf("Expected failed load to not be cached")
+	}
+}
+
+func TestCacheGetOrSetDuringLoaderOutage(t *testing.T) {
+	cache := cache.New(cache.NewConfig[string, string]().LoaderOutageWindow(50 * time.Millisecond))
+	errLoad := errors.New("backend down")
+
+	cache.Set("key1", "stale", time.Millisecond)
+	time.Sleep(5 * time.Millisecond)
+
+	var calls atomic.Int32
+	failing := func() (string, error) {
+		calls.Add(1)
+		return "", errLoad
+	}
+
+	item, err := cache.GetOrSet("key1", time.Minute, failing)
+
+	if err != nil || item == nil || item.Value() != "stale" {
+		t.Fatalf("Expected the stale value to be served when the loader fails, got %v", err)
+	}
+
+	item, err = cache.GetOrSet("key1", time.Minute, failing)
+
+	if err != nil || item == nil || item.Value() != "stale" {
+		t.Errorf("Expected the stale value to be served during the outage, got %v", err)
+	}
+
+	if n := calls.Load(); n != 1 {
+		t.Errorf("Expected the loader to not be called during the outage, got %d calls", n)
+	}
+
+	time.Sleep(60 * time.Millisecond)
+
+	item, err = cache.GetOrSet("key1", time.Minute, func() (string, error) {
+		return "fresh", nil
+	})
+
+	if err != nil || item == nil || item.Value() != "fresh" {
+		t.Errorf("Expected a fresh value once the loader recovers, got %v", err)
+	}
+}
+
+func TestCacheGetOrSetPanickingLoader(t *testing.T) {
+	cache := cache.New(cache.NewConfig[string, string]())
+
+	started := make(chan struct{})
+	release := make(chan struct{})
+	panics := make(chan any, 2)
+	getOrSet := func(loader func() (string, error)) {
+		defer func() { panics <- recover() }()
+		cache.GetOrSet("key1", time.Minute, loader)
+	}
+	go getOrSet(func() (string, error) {
+		close(started)
+		<-release
+		panic("loader failed")
+	})
+	<-started
+	go getOrSet(func() (string, error) {
+		return "", errors.New("waiter loaded")
+	})
+	time.Sleep(10 * time.Millisecond)
+	close(release)
+
+	for range 2 {
+		if r := <-panics; r != "loader failed" {
+			t.Errorf("Expected the loader panic to reach every caller, got %v", r)
+		}
+	}
+
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		item, err := cache.GetOrSet("key1", time.Minute, func() (string, error) { return "value1", nil })
+		if err != nil || item == nil || item.Value() != "value1" {
+			t.Errorf("Expected a new load after the panic, got %v", err)
+		}
+	}()
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Fatalf("Expected GetOrSet to not block after a panicking load")
+	}
+}
+
+func TestCacheGetOrSetContextCancelledWaiter(t *testing.T) {
+	cache := cache.New(cache.NewConfig[string, string]())
+
+	started := make(chan struct{})
+	release := make(chan struct{})
+	loaded := make(chan error)
+	go func() {
+		_, err := cache.GetOrSetContext(context.Background(), "key1", time.Second, func(context.Context) (string, error) {
+			close(started)
+			<-release
+			return "value1", nil
+		})
+		loaded <- err
+	}()
+	<-started
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	_, err := cache.GetOrSetContext(ctx, "key1", time.Second, func(context.Context) (string, error) {
+		t.Errorf("Expected waiter to not call its loader")
+		return "", nil
+	})
+	if !errors.Is(err, context.Canceled) {
+		t.Errorf("Expected error to be %v, got %v", context.Canceled, err)
+	}
+
+	close(release)
+	if err := <-loaded; err != nil {
+		t.Errorf("Expected in-flight load to succeed, got %v", err)
+	}
+	if item := cache.Get("key1"); item == nil || item.Value() != "value1" {
+		t.Errorf("Expected loaded value to be stored despite the cancelled waiter")
+	}
+}
+
+func TestCacheGetOrSetContextCancelledLoader(t *testing.T) {
+	cache := cache.New(cache.NewConfig[string, string]())
+
+	ctx, cancel := context.WithCancel(context.Background())
+	started := make(chan struct{})
+	release := make(chan struct{})
+	first := make(chan error)
+	go func() {
+		_, err := cache.GetOrSetContext(ctx, "key1", time.Second, func(ctx context.Context) (string, error) {
+			close(started)
+			<-release
+			if err := ctx.Err(); err != nil {
+				return "", err
+			}
+			return "value1", nil
+		})
+		first <- err
+	}()
+	<-started
+
+	waited := make(chan string)
+	go func() {
+		item, err := cache.GetOrSetContext(context.Background(), "key1", time.Second, func(context.Context) (string, error) {
+			return "", errors.New("waiter loaded")
+		})
+		if err != nil {
+			t.Errorf("Expected waiter to get the shared value, got %v", err)
+			item = nil
+		}
+		if item == nil {
+			waited <- ""
+			return
+		}
+		waited <- item.Value()
+	}()
+
+	time.Sleep(10 * time.Millisecond)
+	cancel()
+	if err := <-first; !errors.Is(err, context.Canceled) {
+		t.Errorf("Expected the cancelled first caller to return %v, got %v", context.Canceled, err)
+	}
+	close(release)
+	if value := <-waited; value != "value1" {
+		t.Errorf("Expected waiter to get value1 despite the cancelled first caller")
+	}
+}
+
+func TestCacheGetOrSetContextDeadline(t *testing.T) {
+	cache := cache.New(cache.NewConfig[string, string]())
+	release := make(chan struct{})
+	defer close(release)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	start := time.Now()
+	_, err := cache.GetOrSetContext(ctx, "key1", time.Minute, func(context.Context) (string, error) {
+		<-release
+		return "value1", nil
+	})
+
+	if !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("Expected the caller that started the load to return %v, got %v", context.DeadlineExceeded, err)
+	}
+	if elapsed := time.Since(start); elapsed > 200*time.Millisecond {
+		t.Errorf("Expected GetOrSetContext to return at its deadline, took %s", elapsed)
+	}
+}
+
+func TestCacheGetOrSetContextPassesContext(t *testing.T) {
+	cache := cache.New(cache.NewConfig[string, string]())
+	type ctxKey struct{}
+	ctx := context.WithValue(context.Background(), ctxKey{}, "request")
+
+	item, err := cache.GetOrSetContext(ctx, "key1", time.Second, func(ctx context.Context) (string, error) {
+		return ctx.Value(ctxKey{}).(string), nil
+	})
+	if err != nil {
+		t.Errorf("Expected no error, got %v", err)
+	}
+	if item == nil || item.Value() != "request" {
+		t.Errorf("Expected loader to receive the caller's context")
+	}
+}
+
+func TestCacheGetOrSetMulti(t *testing.T) {
+	c := cache.New(cache.NewConfig[string, string]())
+	c.Set("key1", "cached1", time.Minute)
+	c.SetMissing("key3", time.Minute)
+
+	var calls [][]string
+	loader := func(missing []string) (map[string]string, error) {
+		calls = append(calls, missing)
+		return map[string]string{"key2": "loaded2"}, nil
+	}
+
+	items, err := c.GetOrSetMulti([]string{"key1", "key2", "key3", "key4", "key2"}, time.Minute, loader)
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+
+	if len(calls) != 1 {
+		t.Fatalf("Expected loader to be called once, got %d calls", len(calls))
+	}
+	if stats := c.Stats(); stats.Hits != 1 || stats.Misses != 4 {
+		t.Errorf("Expected 1 hit and 4 misses with the tombstone as a miss, got %d and %d", stats.Hits, stats.Misses)
+	}
+	missing := slices.Clone(calls[0])
+	slices.Sort(missing)
+	if expected := []string{"key2", "key4"}; !slices.Equal(missing, expected) {
+		t.Errorf("Expected loader to receive %v, got %v", expected, missing)
+	}
+	if len(items) != 2 || items["key1"].Value() != "cached1" || items["key2"].Value() != "loaded2" {
+		t.Errorf("Expected the cached and loaded items, got %v", items)
+	}
+	if item := c.Get("key2"); item == nil || item.Value() != "loaded2" {
+		t.Errorf("Expected the loaded value to be stored")
+	}
+	if c.Has("key4") {
+		t.Errorf("Expected keys left out by the loader to not be stored")
+	}
+
+	if _, err := c.GetOrSetMulti([]string{"key1", "key2"}, time.Minute, loader); err != nil || len(calls) != 1 {
+		t.Errorf("Expected loader to not be called when every key is cached")
+	}
+}
+
+func TestCacheGetOrSetMultiError(t *testing.T) {
+	c := cache.New(cache.NewConfig[string, string]())
+	c.Set("key1", "cached1", time.Minute)
+	errLoad := errors.New("load failed")
+
+	items, err := c.GetOrSetMulti([]string{"key1", "key2"}, time.Minute, func([]string) (map[string]string, error) {
+		return map[string]string{"key2": "loaded2"}, errLoad
+	})
+
+	if !errors.Is(err, errLoad) {
+		t.Errorf("Expected error to be %v, got %v", errLoad, err)
+	}
+	if len(items) != 1 || items["key1"] == nil {
+		t.Errorf("Expected the cached item to be returned with the error, got %v", items)
+	}
+	if c.Has("key2") {
+		t.Errorf("Expected nothing to be stored when the loader fails")
+	}
+}
+
+func TestCacheLoader(t *testing.T) {
+	var calls atomic.Int32
+	config := cache.NewConfig[string, string]().Loader(func(key string) (string, time.Duration, error) {
+		calls.Add(1)
+		time.Sleep(10 * time.Millisecond)
+		return "loaded:" + key, time.Minute, nil
+	})
+	cache := cache.New(config)
+
+	var wg sync.WaitGroup
+	for range 10 {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if item := cache.Get("key1"); item == nil || item.Value() != "loaded:key1" {
+				t.Errorf("Expected Get to return the loaded value")
+			}
+		}()
+	}
+	wg.Wait()
+
+	if n := calls.Load(); n != 1 {
+		t.Errorf("Expected loader to be called once, got %d", n)
+	}
+	if item := cache.Get("key1"); item == nil || item.TTL() < time.Minute-time.Second {
+		t.Errorf("Expected loaded value to be stored with the loader's TTL")
+	}
+
+	stats := cache.Stats()
+	if stats.Loads != 1 {
+		t.Errorf("Expected 1 load, got %d", stats.Loads)
+	}
+	if stats.Hits != 1 {
+		t.Errorf("Expected only the last Get to be a hit, got %d", stats.Hits)
+	}
+}
+
+func TestCacheLoaderError(t *testing.T) {
+	errLoad := errors.New("load failed")
+	var reported error
+	config := cache.NewConfig[string, string]().
+		Loader(func(key string) (string, time.Duration, error) {
+			return "", 0, errLoad
+		}).
+		ErrorHandler(func(err error) {
+			reported = err
+		})
+	cache := cache.New(config)
+
+	if item := cache.Get("key1"); item != nil {
+		t.Errorf("Expected nil item when the loader fails")
+	}
+	if !errors.Is(reported, errLoad) {
+		t.Errorf("Expected loader error to be reported, got %v", reported)
+	}
+	if loads := cache.Stats().Loads; loads != 0 {
+		t.Errorf("Expected no loads, got %d", loads)
+	}
+}
+
+func TestCacheLoaderOutage(t *testing.T) {
+	var calls atomic.Int32
+	config := cache.NewConfig[string, string]().
+		LoaderOutageWindow(50 * time.Millisecond).
+		Loader(func(key string) (string, time.Duration, error) {
+			calls.Add(1)
+			return "", 0, errors.New("backend down")
+		})
+	cache := cache.New(config)
+
+	cache.Set("key1", "stale", time.Millisecond)
+	time.Sleep(5 * time.Millisecond)
+
+	for range 3 {
+		if item := cache.Get("key1"); item == nil || item.Value() != "stale" {
+			t.Fatalf("Expected the stale value to be served while the loader fails")
+		}
+	}
+	if n := calls.Load(); n != 1 {
+		t.Errorf("Expected the loader to not be called during the outage, got %d calls", n)
+	}
+
+	time.Sleep(60 * time.Millisecond)
+	cache.Get("key1")
+
+	if n := calls.Load(); n != 2 {
+		t.Errorf("Expected the loader to be called again once the outage window passed, got %d calls", n)
+	}
+}
+
+func TestCacheStaleWhileRevalidate(t *testing.T) {
+	clock := &fakeClock{now: time.Unix(1000, 0)}
+	release := make(chan struct{})
+	var calls atomic.Int32
+	c := cache.New(cache.NewConfig[string, string]().Clock(clock).StaleWhileRevalidate(time.Minute).
+		Loader(func(key string) (string, time.Duration, error) {
+			calls.Add(1)
+			<-release
+			return "fresh", time.Hour, nil
+		}))
+
+	c.Set("key1", "stale", time.Second)
+	clock.Advance(2 * time.Second)
+
+	for range 3 {
+		if item := c.Get("key1"); item == nil || item.Value() != "stale" {
+			t.Fatalf("Expected the stale value while the reload is running")
+		}
+	}
+
+	close(release)
+	waitFor(func() bool { return c.Peek("key1").Value() == "fresh" })
+
+	if item := c.Get("key1"); item == nil || item.Value() != "fresh" {
+		t.Errorf("Expected the fresh value once the reload completed")
+	}
+	if n := calls.Load(); n != 1 {
+		t.Errorf("Expected a single background reload, got %d", n)
+	}
+
+	clock.Advance(2 * time.Hour)
+	if item := c.Get("key1"); item == nil || item.Value() != "fresh" || item.Expired() {
+		t.Errorf("Expected an item expired past the grace to be loaded synchronously")
+	}
+	if n := calls.Load(); n != 2 {
+		t.Errorf("Expected a second load, got %d", n)
+	}
+}
+
+func TestCacheCloseWaitsForRevalidation(t *testing.T) {
+	clock := &fakeClock{now: time.Unix(1000, 0)}
+	started := make(chan struct{})
+	release := make(chan struct{})
+	var calls atomic.Int32
+	c := cache.New(cache.NewConfig[string, string]().Clock(clock).StaleWhileRevalidate(time.Minute).
+		Loader(func(key string) (string, time.Duration, error) {
+			if calls.Add(1) == 1 {
+				close(started)
+			}
+			<-release
+			return "fresh", time.Hour, nil
+		}))
+
+	c.Set("key1", "stale", time.Second)
+	clock.Advance(2 * time.Second)
+	c.Get("key1")
+	<-started
+
+	closed := make(chan struct{})
+	go func() {
+		c.Close()
+		close(closed)
+	}()
+	select {
+	case <-closed:
+		t.Fatalf("Expected Close to wait for the background reload")
+	case <-time.After(20 * time.Millisecond):
+	}
+	close(release)
+	<-closed
+
+	// The reload finished after Close had started, so its value was rejected and the stale one is still in grace.
+	if item := c.Get("key1"); item == nil || item.Value() != "stale" {
+		t.Errorf("Expected the stale value to still be served once the cache is closed")
+	}
+	time.Sleep(10 * time.Millisecond)
+	if n := calls.Load(); n != 1 {
+		t.Errorf("Expected no reload once the cache is closed, got %d calls", n)
+	}
+}
+
+func TestCacheSetMissing(t *testing.T) {
+	cache := cache.New(cache.NewConfig[string, string]())
+
+	cache.SetMissing("key1", time.Minute)
+
+	if !cache.GetMissing("key1") {
+		t.Errorf("Expected key to be stored as missing")
+	}
+	if cache.Has("key1") {
+		t.Errorf("Expected missing key to not exist")
+	}
+	if item := cache.Get("key1"); item != nil {
+		t.Errorf("Expected Get to return nil for a missing key")
+	}
+
+	cache.Set("key1", "value1", time.Minute)
+
+	if cache.GetMissing("key1") {
+		t.Errorf("Expected Set to replace the tombstone")
+	}
+	if item := cache.Get("key1"); item == nil || item.Value() != "value1" {
+		t.Errorf("Expected Get to return the value set after the tombstone")
+	}
+}
+
+func TestCacheTombstoneIsNotListed(t *testing.T) {
+	c := cache.New(cache.NewConfig[string, string]())
+	c.Set("key1", "value1", time.Minute)
+	c.SetMissing("key2", time.Minute)
+
+	if items := c.GetMulti([]string{"key1", "key2"}); len(items) != 1 || items["key1"] == nil {
+		t.Errorf("Expected GetMulti to leave out the tombstone, got %v", items)
+	}
+	if stats := c.Stats(); stats.Hits != 1 || stats.Misses != 1 {
+		t.Errorf("Expected the tombstone to count as a miss, got %d hits and %d misses", stats.Hits, stats.Misses)
+	}
+	if found := c.TouchMany([]string{"key1", "key2"}); found != 1 {
+		t.Errorf("Expected TouchMany to find 1 key, got %d", found)
+	}
+	if keys := c.Keys(); !slices.Equal(keys, []string{"key1"}) {
+		t.Errorf("Expected Keys to leave out the tombstone, got %v", keys)
+	}
+	if items := c.Filter("key"); len(items) != 1 {
+		t.Errorf("Expected Filter to leave out the tombstone, got %d items", len(items))
+	}
+	top := c.TopBy(2, func(a, b *cache.Item[string, string]) bool { return a.Key() < b.Key() })
+	if len(top) != 1 {
+		t.Errorf("Expected TopBy to leave out the tombstone, got %d items", len(top))
+	}
+}
+
+func TestCacheTombstoneIsNotEvicted(t *testing.T) {
+	var mu sync.Mutex
+	var evicted []string
+	cache := cache.New(cache.NewConfig[string, string]().OnEvict(func(key, value string, reason cache.EvictReason) {
+		mu.Lock()
+		defer mu.Unlock()
+		evicted = append(evicted, key+"="+value)
+	}))
+
+	cache.SetMissing("key1", time.Minute)
+	cache.Set("key1", "value1", time.Minute)
+	cache.SetMissing("key2", time.Minute)
+	cache.Delete("key2")
+	cache.SetMissing("key3", time.Minute)
+	cache.Clear()
+
+	mu.Lock()
+	defer mu.Unlock()
+	if !slices.Equal(evicted, []string{"key1=value1"}) {
+		t.Errorf("Expected only key1=value1 to reach OnEvict, got %v", evicted)
+	}
+}
+
+func TestCacheTombstoneIsAbsent(t *testing.T) {
+	cache := cache.New(cache.NewConfig[string, string]())
+	cache.SetMissing("key1", time.Minute)
+
+	if cache.Replace("key1", "value1") {
+		t.Errorf("Expected Replace to skip a tombstone")
+	}
+	if cache.CompareAndSwap("key1", "", "value1", func(a, b string) bool { return a == b }) {
+		t.Errorf("Expected CompareAndSwap to skip a tombstone")
+	}
+	if cache.Touch("key1") {
+		t.Errorf("Expected Touch to skip a tombstone")
+	}
+	if cache.Extend("key1", time.Hour) {
+		t.Errorf("Expected Extend to skip a tombstone")
+	}
+	if cache.SetDeadline("key1", time.Now().Add(time.Hour)) {
+		t.Errorf("Expected SetDeadline to skip a tombstone")
+	}
+	if !cache.GetMissing("key1") {
+		t.Errorf("Expected the tombstone to be left in place")
+	}
+
+	if !cache.SetNX("key1", "value1", time.Minute) {
+		t.Errorf("Expected SetNX to insert over a tombstone")
+	}
+	if item := cache.Get("key1"); item == nil || item.Value() != "value1" {
+		t.Errorf("Expected Get to return the value stored by SetNX")
+	}
+}
+
+func TestCacheGetOrSetMissing(t *testing.T) {
+	c := cache.New(cache.NewConfig[string, string]())
+	var calls atomic.Int32
+	loader := func() (string, error) {
+		calls.Add(1)
+		return "value1", nil
+	}
+
+	c.SetMissing("key1", 5*time.Millisecond)
+
+	if _, err := c.GetOrSet("key1", time.Minute, loader); !errors.Is(err, cache.ErrNotFound) {
+		t.Errorf("Expected ErrNotFound for a missing key, got %v", err)
+	}
+	if n := calls.Load(); n != 0 {
+		t.Errorf("Expected loader to not be called for a missing key, got %d calls", n)
+	}
+
+	time.Sleep(10 * time.Millisecond)
+
+	if item, err := c.GetOrSet("key1", time.Minute, loader); err != nil || item.Value() != "value1" {
+		t.Errorf("Expected key to be loaded once the tombstone expired, got %v", err)
+	}
+}
+
+func TestCacheLoaderMissing(t *testing.T) {
+	var calls atomic.Int32
+	cache := cache.New(cache.NewConfig[string, string]().Loader(func(key string) (string, time.Duration, error) {
+		calls.Add(1)
+		return "loaded:" + key, time.Minute, nil
+	}))
+
+	cache.SetMissing("key1", time.Minute)
+
+	if item := cache.Get("key1"); item != nil {
+		t.Errorf("Expected Get to return nil for a missing key")
+	}
+	if n := calls.Load(); n != 0 {
+		t.Errorf("Expected loader to not be called for a missing key, got %d calls", n)
+	}
+}
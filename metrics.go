@@ -0,0 +1,74 @@
+package cache
+
+import (
+	"bufio"
+	"expvar"
+	"fmt"
+	"io"
+)
+
+// metric is a single sample written by WriteMetrics.
+type metric struct {
+	name  string
+	kind  string
+	help  string
+	value int64
+}
+
+// WriteMetrics writes the stats, the item count and the size of the cache to w in the Prometheus
+// text exposition format, with names prefixed by the configured MetricsPrefix, "cache" by default.
+// Counters are cumulative, so they go back to zero after ResetStats.
+func (c *Cache[K, V]) WriteMetrics(w io.Writer) error {
+	stats := c.Stats()
+	metrics := []metric{
+		{"hits_total", "counter", "Gets that found a live item.", stats.Hits},
+		{"misses_total", "counter", "Gets that found no item or an expired one.", stats.Misses},
+		{"evictions_total", "counter", "Items pruned to make room.", stats.Evictions},
+		{"expirations_total", "counter", "Expired items removed from the cache.", stats.Expirations},
+		{"items", "gauge", "Items in the cache, including expired items not removed yet.", int64(stats.ItemCount)},
+		{"size", "gauge", "Total weight of the items tracked by the cache.", int64(c.Size())},
+		{"max_size", "gauge", "Maximum total weight of the items.", int64(c.MaxSizeValue())},
+	}
+
+	b := bufio.NewWriter(w)
+	for _, m := range metrics {
+		name := c.metricsPrefix + "_" + m.name
+		fmt.Fprintf(b, "# HELP %s %s\n# TYPE %s %s\n%s %d\n", name, m.help, name, m.kind, name, m.value)
+	}
+	return b.Flush()
+}
+
+// expvarStats is the value published by PublishExpvar.
+type expvarStats struct {
+	Stats
+	Size    int
+	MaxSize int
+}
+
+// PublishExpvar publishes the stats of the cache, along with its size and max size, as the expvar
+// variable name, so they show up at /debug/vars. They are computed each time the variable is read.
+// Like expvar.Publish, it panics if a variable with that name is already published, which includes
+// calling it twice with the same name: give each cache its own name, and publish it once, for instance
+// right after New, or check expvar.Get(name) first. Variables cannot be unpublished,
+// so a closed cache keeps reporting its last stats.
+func (c *Cache[K, V]) PublishExpvar(name string) {
+	expvar.Publish(name, expvar.Func(func() any {
+		return expvarStats{Stats: c.Stats(), Size: c.Size(), MaxSize: c.MaxSizeValue()}
+	}))
+}
+
+// validMetricName reports whether name matches the Prometheus metric name syntax [a-zA-Z_:][a-zA-Z0-9_:]*.
+func validMetricName(name string) bool {
+	if name == "" {
+		return false
+	}
+	for i, r := range name {
+		switch {
+		case r >= 'a' && r <= 'z', r >= 'A' && r <= 'Z', r == '_', r == ':':
+		case r >= '0' && r <= '9' && i > 0:
+		default:
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,242 @@
+package cache
+
+import (
+	"container/heap"
+	"math/rand/v2"
+	"sync/atomic"
+)
+
+// Policy selects which item the worker evicts when the cache grows over its maximum size.
+type Policy int
+
+const (
+	// LRU evicts the least recently used item. It is the default.
+	LRU Policy = iota
+	// LFU evicts the least frequently used item, the oldest one among equally used items.
+	LFU
+	// FIFO evicts the oldest item, ignoring accesses.
+	FIFO
+)
+
+// policy tracks the items of a cache in eviction order.
+// It is only used by the goroutine of its worker, so it does not need to be safe for concurrent use.
+type policy[K comparable, V any] interface {
+	// push starts tracking a new item.
+	push(item *Item[K, V])
+	// touch records an access to a tracked item. force skips any throttling of the policy.
+	touch(item *Item[K, V], force bool)
+	// remove stops tracking an item.
+	remove(item *Item[K, V])
+	// victim returns the next item to evict, or nil if no item is tracked.
+	victim() *Item[K, V]
+	// len returns the number of tracked items.
+	len() int
+}
+
+func newPolicy[K comparable, V any](config *Config[K, V], shards []*shard[K, V]) policy[K, V] {
+	if config.sampled() {
+		size := config.sampleSize
+		if size == 0 {
+			size = defaultCostSampleSize
+		}
+		return &sampledPolicy[K, V]{shards: shards, size: size, cost: config.costFunction}
+	}
+	switch config.evictionPolicy {
+	case LFU:
+		return &lfuPolicy[K, V]{}
+	case FIFO:
+		return &fifoPolicy[K, V]{queue: newQueue[*Item[K, V]]()}
+	default:
+		return &lruPolicy[K, V]{queue: newQueue[*Item[K, V]](), getsPerPromote: int32(config.getsPerPromote)}
+	}
+}
+
+// lruPolicy moves items to the front of its queue when they are promoted and evicts from the tail.
+// Items are only promoted every getsPerPromote accesses, to limit the work of the worker on hot keys.
+type lruPolicy[K comparable, V any] struct {
+	queue          *queue[*Item[K, V]]
+	getsPerPromote int32
+}
+
+func (p *lruPolicy[K, V]) push(item *Item[K, V]) {
+	item.node = p.queue.pushToFront(item)
+}
+
+func (p *lruPolicy[K, V]) touch(item *Item[K, V], force bool) {
+	if force || item.shouldPromote(p.getsPerPromote) {
+		p.queue.moveToFront(item.node)
+		item.promotions = 0
+	}
+}
+
+func (p *lruPolicy[K, V]) remove(item *Item[K, V]) {
+	p.queue.remove(item.node)
+	item.node = nil
+}
+
+func (p *lruPolicy[K, V]) victim() *Item[K, V] {
+	if p.queue.tail == nil {
+		return nil
+	}
+	return p.queue.tail.value
+}
+
+func (p *lruPolicy[K, V]) len() int {
+	return p.queue.len()
+}
+
+// fifoPolicy evicts items in the order they were stored.
+type fifoPolicy[K comparable, V any] struct {
+	queue *queue[*Item[K, V]]
+}
+
+func (p *fifoPolicy[K, V]) push(item *Item[K, V]) {
+	item.node = p.queue.pushToFront(item)
+}
+
+func (p *fifoPolicy[K, V]) touch(item *Item[K, V], force bool) {}
+
+func (p *fifoPolicy[K, V]) remove(item *Item[K, V]) {
+	p.queue.remove(item.node)
+	item.node = nil
+}
+
+func (p *fifoPolicy[K, V]) victim() *Item[K, V] {
+	if p.queue.tail == nil {
+		return nil
+	}
+	return p.queue.tail.value
+}
+
+func (p *fifoPolicy[K, V]) len() int {
+	return p.queue.len()
+}
+
+// lfuPolicy keeps items in a min-heap ordered by access count, then by the tick of their last access.
+type lfuPolicy[K comparable, V any] struct {
+	items []*Item[K, V]
+	tick  uint64
+}
+
+func (p *lfuPolicy[K, V]) push(item *Item[K, V]) {
+	p.tick++
+	item.hits = 0
+	item.tick = p.tick
+	heap.Push(p, item)
+}
+
+func (p *lfuPolicy[K, V]) touch(item *Item[K, V], force bool) {
+	p.tick++
+	item.hits++
+	item.tick = p.tick
+	heap.Fix(p, item.index)
+}
+
+func (p *lfuPolicy[K, V]) remove(item *Item[K, V]) {
+	heap.Remove(p, item.index)
+}
+
+func (p *lfuPolicy[K, V]) victim() *Item[K, V] {
+	if len(p.items) == 0 {
+		return nil
+	}
+	return p.items[0]
+}
+
+func (p *lfuPolicy[K, V]) len() int {
+	return len(p.items)
+}
+
+func (p *lfuPolicy[K, V]) Len() int {
+	return len(p.items)
+}
+
+func (p *lfuPolicy[K, V]) Less(i, j int) bool {
+	a, b := p.items[i], p.items[j]
+	if a.hits != b.hits {
+		return a.hits < b.hits
+	}
+	return a.tick < b.tick
+}
+
+func (p *lfuPolicy[K, V]) Swap(i, j int) {
+	p.items[i], p.items[j] = p.items[j], p.items[i]
+	p.items[i].index = i
+	p.items[j].index = j
+}
+
+func (p *lfuPolicy[K, V]) Push(x any) {
+	item := x.(*Item[K, V])
+	item.index = len(p.items)
+	p.items = append(p.items, item)
+}
+
+func (p *lfuPolicy[K, V]) Pop() any {
+	item := p.items[len(p.items)-1]
+	p.items[len(p.items)-1] = nil
+	p.items = p.items[:len(p.items)-1]
+	item.index = -1
+	return item
+}
+
+// defaultCostSampleSize is the number of items sampled on eviction when a CostFunction is set without a SampleSize.
+const defaultCostSampleSize = 16
+
+// sampledPolicy keeps no global order: on eviction it samples random items across the shards
+// and picks the one with the lowest score: the configured cost, or else the time of the last access,
+// which Get records on the item itself. This spares Get the promotions sent to the worker by the other policies.
+type sampledPolicy[K comparable, V any] struct {
+	shards []*shard[K, V]
+	size   int
+	cost   func(item *Item[K, V]) float64
+}
+
+func (p *sampledPolicy[K, V]) push(item *Item[K, V]) {
+	item.access()
+}
+
+func (p *sampledPolicy[K, V]) touch(item *Item[K, V], force bool) {
+	item.access()
+}
+
+func (p *sampledPolicy[K, V]) remove(item *Item[K, V]) {}
+
+// score returns the eviction score of an item, the lowest being evicted first.
+func (p *sampledPolicy[K, V]) score(item *Item[K, V]) float64 {
+	if p.cost != nil {
+		return p.cost(item)
+	}
+	return float64(atomic.LoadInt64(&item.accessed))
+}
+
+func (p *sampledPolicy[K, V]) victim() *Item[K, V] {
+	var lowest *Item[K, V]
+	var lowestScore float64
+	// Empty shards and items the worker does not track yet are skipped,
+	// giving up after a few attempts per sample so a nearly empty cache does not spin.
+	for found, attempts := 0, 0; found < p.size && attempts < 4*p.size; attempts++ {
+		item := p.shards[rand.IntN(len(p.shards))].sample()
+		if item == nil || !item.tracked {
+			continue
+		}
+		found++
+		if score := p.score(item); lowest == nil || score < lowestScore {
+			lowest, lowestScore = item, score
+		}
+	}
+	return lowest
+}
+
+// len counts the tracked items of the shards, since the policy keeps no structure of its own.
+func (p *sampledPolicy[K, V]) len() int {
+	n := 0
+	for _, s := range p.shards {
+		s.forEachItem(func(item *Item[K, V]) bool {
+			if item.tracked {
+				n++
+			}
+			return true
+		})
+	}
+	return n
+}
@@ -2,6 +2,7 @@ package cache
 
 // node represents a node in a queue.
 // The value of the node is supposed to be the item, and the item and the node should have cyclic relationship.
+// It is not part of the public API: an Item only keeps its node so the policy can move or remove it in constant time.
 type node[T any] struct {
 	next  *node[T]
 	prev  *node[T]
@@ -81,3 +82,13 @@ func (q *queue[T]) moveToFront(node *node[T]) {
 		q.tail = node
 	}
 }
+
+// len returns the number of nodes in the queue by walking it from its head.
+// It is linear in the length of the queue and only meant for diagnostics.
+func (q *queue[T]) len() int {
+	n := 0
+	for node := q.head; node != nil; node = node.next {
+		n++
+	}
+	return n
+}
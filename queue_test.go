@@ -0,0 +1,42 @@
+package cache
+
+import (
+	"strconv"
+	"testing"
+	"time"
+)
+
+func TestQueueLen(t *testing.T) {
+	q := newQueue[int]()
+	first := q.pushToFront(1)
+	q.pushToFront(2)
+	last := q.pushToFront(3)
+
+	q.moveToFront(first)
+	q.remove(last)
+
+	if n := q.len(); n != 2 {
+		t.Errorf("Expected queue length to be 2, got %d", n)
+	}
+}
+
+func TestCacheQueueLen(t *testing.T) {
+	for _, policy := range []Policy{LRU, LFU, FIFO} {
+		c := New(NewConfig[string, int]().ByCount().MaxSize(50).ItemsToPrune(5).EvictionPolicy(policy).Workers(4))
+
+		for i := range 100 {
+			c.Set("key"+strconv.Itoa(i), i, time.Minute)
+			c.Get("key" + strconv.Itoa(i/2))
+		}
+		for i := range 20 {
+			c.Delete("key" + strconv.Itoa(i*5))
+		}
+		c.Replace("key99", 0)
+		c.Sync()
+
+		if n, count := c.queueLen(), c.ItemCount(); n != count {
+			t.Errorf("Expected the %v queue length to match the item count %d, got %d", policy, count, n)
+		}
+		c.Close()
+	}
+}
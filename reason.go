@@ -0,0 +1,22 @@
+package cache
+
+// EvictReason tells the OnEvict callback why an item left the cache.
+type EvictReason int
+
+const (
+	// Evicted is the reason for items pruned to make room: when the cache grows over its max size,
+	// when its budget is exceeded, and with TrimToSize or a shrinking SetMaxSize.
+	Evicted EvictReason = iota
+	// Expired is the reason for expired items removed by the janitor or DeleteExpired,
+	// and for items that had already expired when they were pruned to make room.
+	Expired
+	// Deleted is the reason for items removed by Delete, DeleteMulti and DeletePrefix.
+	Deleted
+	// Cleared is the reason for items removed by Clear.
+	Cleared
+	// Replaced is the reason for items overwritten with a different value by Set, SetNX, SetMulti,
+	// Replace, CompareAndSwap, Increment or Decrement. Overwriting with an equal value does not invoke the callback.
+	Replaced
+	// Shutdown is the reason for items removed by DrainAndClose.
+	Shutdown
+)
@@ -1,38 +1,157 @@
 package cache
 
 import (
+	"math/rand/v2"
 	"sync"
-	"time"
+	"sync/atomic"
 )
 
-type shard[T any] struct {
+type shard[K comparable, V any] struct {
 	sync.RWMutex
-	store map[string]*Item[T]
+	store    map[K]*Item[K, V]
+	counters *shardCounters
+	// rand is the random source for TTL jitter, only allocated when the configuration enables it.
+	// It is kept per shard to avoid contention on a single source.
+	randMu sync.Mutex
+	rand   *rand.Rand
 }
 
-func (s *shard[T]) itemCount() int {
+// shardCounters counts the operations performed on a shard.
+// It is only allocated when the configuration enables shard counters.
+type shardCounters struct {
+	gets    atomic.Int64
+	sets    atomic.Int64
+	deletes atomic.Int64
+}
+
+// random returns a pseudo-random number in [0, 1) from the shard's random source.
+func (s *shard[K, V]) random() float64 {
+	s.randMu.Lock()
+	defer s.randMu.Unlock()
+	return s.rand.Float64()
+}
+
+func (s *shard[K, V]) itemCount() int {
 	s.RLock()
 	defer s.RUnlock()
 	return len(s.store)
 }
 
-func (s *shard[T]) get(key string) *Item[T] {
+func (s *shard[K, V]) get(key K) *Item[K, V] {
+	if s.counters != nil {
+		s.counters.gets.Add(1)
+	}
 	s.RLock()
 	defer s.RUnlock()
 	return s.store[key]
 }
 
-func (s *shard[T]) set(key string, value T, duration time.Duration) (*Item[T], *Item[T]) {
-	expires := time.Now().Add(duration).UnixNano()
-	item := newItem(key, value, expires)
+// refresh sets the expiration of the live item for the key and returns it,
+// or nil if it is missing, expired or a tombstone.
+// The read lock is enough for the atomic store and keeps the item from being removed in between.
+func (s *shard[K, V]) refresh(key K, expires int64) *Item[K, V] {
+	if s.counters != nil {
+		s.counters.gets.Add(1)
+	}
+	s.RLock()
+	defer s.RUnlock()
+	item := s.store[key]
+	if item == nil || item.Expired() || item.missing {
+		return nil
+	}
+	atomic.StoreInt64(&item.expires, expires)
+	return item
+}
+
+// sample returns an arbitrary item of the shard, or nil if it is empty.
+func (s *shard[K, V]) sample() *Item[K, V] {
+	s.RLock()
+	defer s.RUnlock()
+	for _, item := range s.store {
+		return item
+	}
+	return nil
+}
+
+// getMany looks up the keys of the lookups under a single read lock,
+// storing the item found for each of them, or nil if it is missing.
+func (s *shard[K, V]) getMany(lookups []lookup[K, V]) {
+	if s.counters != nil {
+		s.counters.gets.Add(int64(len(lookups)))
+	}
+	s.RLock()
+	defer s.RUnlock()
+	for i := range lookups {
+		lookups[i].item = s.store[lookups[i].key]
+	}
+}
+
+// set stores the item and returns the item it replaced, if any.
+func (s *shard[K, V]) set(item *Item[K, V]) *Item[K, V] {
+	if s.counters != nil {
+		s.counters.sets.Add(1)
+	}
+	s.Lock()
+	existing := s.store[item.key]
+	s.store[item.key] = item
+	s.Unlock()
+	return existing
+}
+
+// setMany stores the items under a single write lock and returns the items they replaced,
+// aligned with items and holding nil where nothing was replaced.
+func (s *shard[K, V]) setMany(items []*Item[K, V]) []*Item[K, V] {
+	if s.counters != nil {
+		s.counters.sets.Add(int64(len(items)))
+	}
+	replaced := make([]*Item[K, V], len(items))
 	s.Lock()
+	defer s.Unlock()
+	for i, item := range items {
+		replaced[i] = s.store[item.key]
+		s.store[item.key] = item
+	}
+	return replaced
+}
+
+// setNX stores the item unless a live item already exists for its key, a tombstone counting as absent.
+// It reports whether the item was stored, along with the expired item or tombstone it replaced, if any.
+func (s *shard[K, V]) setNX(item *Item[K, V]) (bool, *Item[K, V]) {
+	if s.counters != nil {
+		s.counters.sets.Add(1)
+	}
+	s.Lock()
+	defer s.Unlock()
+	existing := s.store[item.key]
+	if existing != nil && !existing.Expired() && !existing.missing {
+		return false, nil
+	}
+	s.store[item.key] = item
+	return true, existing
+}
+
+// update replaces the item for the key with the one returned by fn, under the write lock.
+// fn receives the current item, or nil if there is none, and may return nil to leave the shard unchanged.
+// It returns the new item and the item it replaced.
+func (s *shard[K, V]) update(key K, fn func(existing *Item[K, V]) *Item[K, V]) (*Item[K, V], *Item[K, V]) {
+	if s.counters != nil {
+		s.counters.sets.Add(1)
+	}
+	s.Lock()
+	defer s.Unlock()
 	existing := s.store[key]
+	item := fn(existing)
+	if item == nil {
+		return nil, nil
+	}
 	s.store[key] = item
-	s.Unlock()
 	return item, existing
 }
 
-func (s *shard[T]) delete(key string) *Item[T] {
+func (s *shard[K, V]) delete(key K) *Item[K, V] {
+	if s.counters != nil {
+		s.counters.deletes.Add(1)
+	}
 	s.Lock()
 	item := s.store[key]
 	delete(s.store, key)
@@ -40,8 +159,76 @@ func (s *shard[T]) delete(key string) *Item[T] {
 	return item
 }
 
-func (s *shard[T]) clear() {
+// deleteItem removes the item from the shard only if it is still the one stored for its key,
+// and reports whether it did. An item that was replaced in the meantime leaves the newer one in place.
+func (s *shard[K, V]) deleteItem(item *Item[K, V]) bool {
+	if s.counters != nil {
+		s.counters.deletes.Add(1)
+	}
+	s.Lock()
+	defer s.Unlock()
+	if s.store[item.key] != item {
+		return false
+	}
+	delete(s.store, item.key)
+	return true
+}
+
+// forEachItem calls fn for every item in the shard under the read lock, stopping when fn returns false.
+func (s *shard[K, V]) forEachItem(fn func(item *Item[K, V]) bool) bool {
+	s.RLock()
+	defer s.RUnlock()
+	for _, item := range s.store {
+		if !fn(item) {
+			return false
+		}
+	}
+	return true
+}
+
+// deleteMany removes the keys under a single write lock and returns the items that were removed.
+func (s *shard[K, V]) deleteMany(keys []K) []*Item[K, V] {
+	if s.counters != nil {
+		s.counters.deletes.Add(int64(len(keys)))
+	}
+	var deleted []*Item[K, V]
+	s.Lock()
+	defer s.Unlock()
+	for _, key := range keys {
+		if item, ok := s.store[key]; ok {
+			delete(s.store, key)
+			deleted = append(deleted, item)
+		}
+	}
+	return deleted
+}
+
+// deleteExpired removes the expired items from the shard and returns them.
+func (s *shard[K, V]) deleteExpired() []*Item[K, V] {
+	return s.deleteFunc(func(item *Item[K, V]) bool {
+		return item.Expired()
+	})
+}
+
+// deleteFunc removes the items for which fn returns true under a single write lock and returns them.
+func (s *shard[K, V]) deleteFunc(fn func(item *Item[K, V]) bool) []*Item[K, V] {
+	var deleted []*Item[K, V]
+	s.Lock()
+	defer s.Unlock()
+	for key, item := range s.store {
+		if fn(item) {
+			delete(s.store, key)
+			deleted = append(deleted, item)
+		}
+	}
+	return deleted
+}
+
+// clear empties the shard and returns the items it held.
+func (s *shard[K, V]) clear() map[K]*Item[K, V] {
 	s.Lock()
-	s.store = make(map[string]*Item[T])
+	store := s.store
+	s.store = make(map[K]*Item[K, V])
 	s.Unlock()
+	return store
 }
@@ -0,0 +1,34 @@
+package cache
+
+import (
+	"hash/fnv"
+	"slices"
+	"strconv"
+	"testing"
+)
+
+func TestShardPlacementIsDeterministic(t *testing.T) {
+	c1 := New(NewConfig[string, int]())
+	c2 := New(NewConfig[string, int]())
+
+	for i := range 100 {
+		key := "key" + strconv.Itoa(i)
+		i1 := slices.Index(c1.shards, c1.getShard(key))
+		i2 := slices.Index(c2.shards, c2.getShard(key))
+
+		if i1 != i2 {
+			t.Errorf("Expected key '%s' to land in the same shard, got %d and %d", key, i1, i2)
+		}
+	}
+}
+
+func TestFNV32aMatchesHashFNV(t *testing.T) {
+	for _, key := range []string{"", "key", "user:123:profile"} {
+		h := fnv.New32a()
+		h.Write([]byte(key))
+
+		if got := fnv32a(key); got != h.Sum32() {
+			t.Errorf("Expected hash of '%s' to be %d, got %d", key, h.Sum32(), got)
+		}
+	}
+}
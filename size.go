@@ -0,0 +1,161 @@
+package cache
+
+import (
+	"reflect"
+	"sync"
+)
+
+// maxSizeDepth bounds how deep estimateSize follows references into nested values.
+const maxSizeDepth = 4
+
+// maxSizeSamples bounds how many elements of a slice or array, or entries of a map, estimateSize walks.
+// The referenced size of larger collections is extrapolated from the ones it walked.
+const maxSizeSamples = 64
+
+// estimateSize returns an estimate of the number of bytes used by a value.
+// Unlike the reflected size of the type, it includes the data referenced by strings,
+// slices, maps and pointers, following references up to maxSizeDepth levels deep.
+func estimateSize(value any) int {
+	v := reflect.ValueOf(value)
+	if !v.IsValid() {
+		return 0
+	}
+	return int(v.Type().Size()) + referencedSize(v, maxSizeDepth)
+}
+
+// referencedSize returns the number of bytes referenced by v outside of its own inline size.
+func referencedSize(v reflect.Value, depth int) int {
+	if depth == 0 {
+		return 0
+	}
+
+	switch v.Kind() {
+	case reflect.String:
+		return v.Len()
+	case reflect.Slice:
+		return v.Len()*int(v.Type().Elem().Size()) + elementsSize(v, depth)
+	case reflect.Array:
+		return elementsSize(v, depth)
+	case reflect.Map:
+		entrySize := int(v.Type().Key().Size() + v.Type().Elem().Size())
+		size := v.Len() * entrySize
+		if !hasReferences(v.Type().Key()) && !hasReferences(v.Type().Elem()) {
+			return size
+		}
+		walked, referenced := 0, 0
+		for iter := v.MapRange(); walked < maxSizeSamples && iter.Next(); walked++ {
+			referenced += referencedSize(iter.Key(), depth-1) + referencedSize(iter.Value(), depth-1)
+		}
+		return size + extrapolate(referenced, walked, v.Len())
+	case reflect.Pointer:
+		if v.IsNil() {
+			return 0
+		}
+		elem := v.Elem()
+		return int(elem.Type().Size()) + referencedSize(elem, depth-1)
+	case reflect.Interface:
+		if v.IsNil() {
+			return 0
+		}
+		elem := v.Elem()
+		return int(elem.Type().Size()) + referencedSize(elem, depth-1)
+	case reflect.Struct:
+		size := 0
+		for i := range v.NumField() {
+			size += referencedSize(v.Field(i), depth)
+		}
+		return size
+	default:
+		return 0
+	}
+}
+
+// elementsSize returns the number of bytes referenced by the elements of a slice or array.
+// Elements without references are skipped altogether, so that large byte slices are weighed in constant time.
+func elementsSize(v reflect.Value, depth int) int {
+	if !hasReferences(v.Type().Elem()) {
+		return 0
+	}
+	walked := min(v.Len(), maxSizeSamples)
+	referenced := 0
+	for i := range walked {
+		referenced += referencedSize(v.Index(i), depth-1)
+	}
+	return extrapolate(referenced, walked, v.Len())
+}
+
+// extrapolate scales the size referenced by the walked elements of a collection to all of its elements.
+func extrapolate(referenced, walked, total int) int {
+	if walked == 0 || walked == total {
+		return referenced
+	}
+	return referenced * total / walked
+}
+
+// hasReferences reports whether values of type t can reference data outside of their inline size,
+// which is the case for strings, slices, maps, pointers and interfaces, and for arrays and structs holding them.
+func hasReferences(t reflect.Type) bool {
+	switch t.Kind() {
+	case reflect.String, reflect.Slice, reflect.Map, reflect.Pointer, reflect.Interface:
+		return true
+	case reflect.Array:
+		return hasReferences(t.Elem())
+	case reflect.Struct:
+		for i := range t.NumField() {
+			if hasReferences(t.Field(i).Type) {
+				return true
+			}
+		}
+		return false
+	default:
+		return false
+	}
+}
+
+// weightMemo remembers the weight of the pointer values held by the items of a cache, so that a value
+// stored under many keys is only weighed once. It counts the items holding each value and forgets
+// the value when the last of them leaves the cache, so it never keeps a value alive on its own.
+type weightMemo[V any] struct {
+	mu      sync.Mutex
+	weights map[any]memoizedWeight
+}
+
+// memoizedWeight is the weight of a value and the number of items of the cache holding it.
+type memoizedWeight struct {
+	size  int
+	items int
+}
+
+func newWeightMemo[V any]() *weightMemo[V] {
+	return &weightMemo[V]{weights: make(map[any]memoizedWeight)}
+}
+
+// get returns the weight remembered for the value, if an item of the cache holds it.
+func (m *weightMemo[V]) get(value V) (int, bool) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	w, ok := m.weights[value]
+	return w.size, ok
+}
+
+// hold records that one more item holds the value, with the given weight.
+func (m *weightMemo[V]) hold(value V, size int) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	w := m.weights[value]
+	m.weights[value] = memoizedWeight{size: size, items: w.items + 1}
+}
+
+// release records that an item holding the value left the cache, forgetting the value with the last of them.
+func (m *weightMemo[V]) release(value V) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	w, ok := m.weights[value]
+	switch {
+	case !ok:
+	case w.items <= 1:
+		delete(m.weights, value)
+	default:
+		m.weights[value] = memoizedWeight{size: w.size, items: w.items - 1}
+	}
+}
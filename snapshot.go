@@ -0,0 +1,86 @@
+package cache
+
+import (
+	"encoding/json"
+	"time"
+)
+
+// Entry is a live item of a cache as exported by Snapshot.
+// TTL is the remaining time to live, NoExpiration for items that never expire.
+type Entry[K comparable, V any] struct {
+	Key   K
+	Value V
+	TTL   time.Duration
+}
+
+// Snapshot returns every non-expired item of the cache, leaving out tombstones stored by SetMissing.
+// Each shard is read under its lock, so the entries of a shard are consistent with each other,
+// though shards are read one after the other while the cache keeps changing.
+func (c *Cache[K, V]) Snapshot() []Entry[K, V] {
+	c.acquireScan()
+	defer c.releaseScan()
+	var entries []Entry[K, V]
+	for _, s := range c.shards {
+		s.forEachItem(func(item *Item[K, V]) bool {
+			if !item.Expired() && !item.missing {
+				entries = append(entries, Entry[K, V]{Key: item.key, Value: item.value, TTL: item.TTL()})
+			}
+			return true
+		})
+	}
+	return entries
+}
+
+// Load stores every entry with its remaining TTL, as if by Set, typically to warm up a cache
+// from a Snapshot of another one. Entries with a non-positive TTL have already expired and are skipped.
+func (c *Cache[K, V]) Load(entries []Entry[K, V]) {
+	for _, entry := range entries {
+		if entry.TTL <= 0 {
+			continue
+		}
+		c.set(entry.Key, entry.Value, entry.TTL)
+	}
+}
+
+// jsonEntry is the JSON representation of an entry, with an absolute expiration time
+// so that the remaining TTL does not depend on when the JSON is read back.
+type jsonEntry[K comparable, V any] struct {
+	Key     K          `json:"key"`
+	Value   V          `json:"value"`
+	Expires *time.Time `json:"expires,omitempty"`
+}
+
+// MarshalJSON encodes the live entries of the cache as a JSON array of objects
+// holding the key, the value and the expiration time, omitted for items that never expire.
+// V must be marshalable with encoding/json; unexported fields of the values are not encoded.
+func (c *Cache[K, V]) MarshalJSON() ([]byte, error) {
+	entries := c.Snapshot()
+	now := time.Unix(0, now(c.clock))
+	out := make([]jsonEntry[K, V], len(entries))
+	for i, entry := range entries {
+		out[i] = jsonEntry[K, V]{Key: entry.Key, Value: entry.Value}
+		if entry.TTL != NoExpiration {
+			expires := now.Add(entry.TTL)
+			out[i].Expires = &expires
+		}
+	}
+	return json.Marshal(out)
+}
+
+// UnmarshalJSON stores the entries encoded by MarshalJSON into the cache, which must have been created by New.
+// Entries whose expiration time has already passed are dropped.
+func (c *Cache[K, V]) UnmarshalJSON(data []byte) error {
+	var in []jsonEntry[K, V]
+	if err := json.Unmarshal(data, &in); err != nil {
+		return err
+	}
+	entries := make([]Entry[K, V], len(in))
+	for i, entry := range in {
+		entries[i] = Entry[K, V]{Key: entry.Key, Value: entry.Value, TTL: NoExpiration}
+		if entry.Expires != nil {
+			entries[i].TTL = entry.Expires.Sub(time.Unix(0, now(c.clock)))
+		}
+	}
+	c.Load(entries)
+	return nil
+}
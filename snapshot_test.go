@@ -0,0 +1,106 @@
+package cache_test
+
+import (
+	"encoding/json"
+	"testing"
+	"time"
+
+	"github.com/mcheviron/cache"
+)
+
+func TestCacheSnapshot(t *testing.T) {
+	noExpiration := cache.NoExpiration
+	cache := cache.New(cache.NewConfig[string, string]())
+
+	cache.Set("key1", "value1", time.Minute)
+	cache.Set("key2", "value2", 0)
+	cache.Set("key3", "value3", time.Millisecond)
+
+	time.Sleep(5 * time.Millisecond)
+
+	entries := cache.Snapshot()
+
+	if len(entries) != 2 {
+		t.Fatalf("Expected 2 live entries, got %d", len(entries))
+	}
+	for _, entry := range entries {
+		switch entry.Key {
+		case "key1":
+			if entry.TTL > time.Minute || entry.TTL < time.Minute-time.Second {
+				t.Errorf("Expected key1 TTL to be about 1 minute, got %s", entry.TTL)
+			}
+		case "key2":
+			if entry.TTL != noExpiration {
+				t.Errorf("Expected key2 TTL to be NoExpiration, got %s", entry.TTL)
+			}
+		default:
+			t.Errorf("Expected expired %s to be skipped", entry.Key)
+		}
+	}
+}
+
+func TestCacheLoad(t *testing.T) {
+	source := cache.New(cache.NewConfig[string, string]())
+	source.Set("key1", "value1", time.Minute)
+	source.Set("key2", "value2", 0)
+
+	target := cache.New(cache.NewConfig[string, string]())
+	target.Load(append(source.Snapshot(), cache.Entry[string, string]{Key: "key3", Value: "value3", TTL: -time.Second}))
+
+	if item := target.Get("key1"); item == nil || item.Value() != "value1" {
+		t.Errorf("Expected key1 to be loaded")
+	} else if ttl := item.TTL(); ttl > time.Minute || ttl < time.Minute-time.Second {
+		t.Errorf("Expected key1 to keep its remaining TTL, got %s", ttl)
+	}
+	if item := target.Get("key2"); item == nil || item.TTL() != cache.NoExpiration {
+		t.Errorf("Expected key2 to be loaded without expiration")
+	}
+	if target.Get("key3") != nil {
+		t.Errorf("Expected expired entry to be skipped")
+	}
+}
+
+func TestCacheJSON(t *testing.T) {
+	type session struct {
+		User  string
+		Admin bool
+	}
+	source := cache.New(cache.NewConfig[string, session]())
+	source.Set("key1", session{User: "alice", Admin: true}, time.Minute)
+	source.Set("key2", session{User: "bob"}, 0)
+
+	data, err := json.Marshal(source)
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+
+	target := cache.New(cache.NewConfig[string, session]())
+	if err := json.Unmarshal(data, target); err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+
+	if item := target.Get("key1"); item == nil || item.Value() != (session{User: "alice", Admin: true}) {
+		t.Errorf("Expected key1 to be restored")
+	} else if ttl := item.TTL(); ttl > time.Minute || ttl < time.Minute-time.Second {
+		t.Errorf("Expected key1 to keep its expiration, got %s", ttl)
+	}
+	if item := target.Get("key2"); item == nil || item.TTL() != cache.NoExpiration {
+		t.Errorf("Expected key2 to be restored without expiration")
+	}
+}
+
+func TestCacheUnmarshalJSONDropsExpiredEntries(t *testing.T) {
+	cache := cache.New(cache.NewConfig[string, string]())
+	data := `[{"key":"key1","value":"value1","expires":"2000-01-01T00:00:00Z"},{"key":"key2","value":"value2"}]`
+
+	if err := json.Unmarshal([]byte(data), cache); err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+
+	if cache.Get("key1") != nil {
+		t.Errorf("Expected expired entry to be dropped")
+	}
+	if item := cache.Get("key2"); item == nil || item.Value() != "value2" {
+		t.Errorf("Expected key2 to be loaded")
+	}
+}
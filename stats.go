@@ -0,0 +1,101 @@
+package cache
+
+import (
+	"sync/atomic"
+	"time"
+)
+
+// Stats is a point-in-time view of the cache's effectiveness counters.
+type Stats struct {
+	Hits              int64
+	Misses            int64
+	Evictions         int64
+	Expirations       int64
+	Rejected          int64
+	Loads             int64
+	DroppedPromotions int64
+	ItemCount         int
+}
+
+// GCStats describes a single pass of the garbage collector that prunes the cache once it exceeds its max size.
+// Examined counts the victims the eviction policy picked, and Evicted those actually removed:
+// a victim already replaced or deleted is only dropped from the policy.
+type GCStats struct {
+	Examined   int
+	Evicted    int
+	SizeBefore int
+	SizeAfter  int
+	Duration   time.Duration
+}
+
+// stats holds the counters updated by cache operations.
+// The fields are accessed concurrently, so they are atomic.
+type stats struct {
+	hits              atomic.Int64
+	misses            atomic.Int64
+	evictions         atomic.Int64
+	expirations       atomic.Int64
+	rejected          atomic.Int64
+	loads             atomic.Int64
+	droppedPromotions atomic.Int64
+}
+
+func (s *stats) reset() {
+	s.hits.Store(0)
+	s.misses.Store(0)
+	s.evictions.Store(0)
+	s.expirations.Store(0)
+	s.rejected.Store(0)
+	s.loads.Store(0)
+	s.droppedPromotions.Store(0)
+}
+
+// Stats returns the current counters of the cache.
+// Hits and misses are counted by Get, where an expired item counts as a miss.
+// Evictions count items pruned by size pressure, Expirations count expired items
+// removed by the janitor or pruned after they had already expired.
+// Rejected counts values that were not stored because they exceeded the maximum item size or the max size.
+// Loads counts values stored by the configured Loader; the Gets that triggered them count as misses.
+// DroppedPromotions counts promotions the worker was too busy to take: Gets that did not move
+// their item in the eviction order, and writes that gave up after the configured PromoteTimeout.
+func (c *Cache[K, V]) Stats() Stats {
+	return Stats{
+		Hits:              c.stats.hits.Load(),
+		Misses:            c.stats.misses.Load(),
+		Evictions:         c.stats.evictions.Load(),
+		Expirations:       c.stats.expirations.Load(),
+		Rejected:          c.stats.rejected.Load(),
+		Loads:             c.stats.loads.Load(),
+		DroppedPromotions: c.stats.droppedPromotions.Load(),
+		ItemCount:         c.ItemCount(),
+	}
+}
+
+// ResetStats sets all counters back to zero, which is useful for periodic sampling.
+func (c *Cache[K, V]) ResetStats() {
+	c.stats.reset()
+}
+
+// ShardStats describes the content of a single shard and, when shard counters are enabled,
+// how many operations it has served.
+type ShardStats struct {
+	ItemCount int
+	Gets      int64
+	Sets      int64
+	Deletes   int64
+}
+
+// ShardStats returns the stats of every shard, in shard order.
+// The operation counters are only tracked when enabled with Config.ShardCounters.
+func (c *Cache[K, V]) ShardStats() []ShardStats {
+	result := make([]ShardStats, len(c.shards))
+	for i, s := range c.shards {
+		result[i].ItemCount = s.itemCount()
+		if s.counters != nil {
+			result[i].Gets = s.counters.gets.Load()
+			result[i].Sets = s.counters.sets.Load()
+			result[i].Deletes = s.counters.deletes.Load()
+		}
+	}
+	return result
+}
@@ -0,0 +1,198 @@
+package cache_test
+
+import (
+	"encoding/json"
+	"expvar"
+	"reflect"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/mcheviron/cache"
+)
+
+func TestCacheStats(t *testing.T) {
+	cache := cache.New(cache.NewConfig[string, string]())
+
+	cache.Set("key1", "value1", time.Second)
+	cache.Set("key2", "value2", time.Nanosecond)
+	time.Sleep(time.Millisecond)
+
+	cache.Get("key1")
+	cache.Get("key1")
+	cache.Get("key2")
+	cache.Get("key3")
+
+	stats := cache.Stats()
+
+	if stats.Hits != 2 {
+		t.Errorf("Expected hits to be 2, got %d", stats.Hits)
+	}
+
+	if stats.Misses != 2 {
+		t.Errorf("Expected misses to be 2, got %d", stats.Misses)
+	}
+
+	if stats.ItemCount != 2 {
+		t.Errorf("Expected item count to be 2, got %d", stats.ItemCount)
+	}
+
+	cache.ResetStats()
+	stats = cache.Stats()
+
+	if stats.Hits != 0 || stats.Misses != 0 {
+		t.Errorf("Expected counters to be 0 after reset, got %d hits and %d misses", stats.Hits, stats.Misses)
+	}
+}
+
+func TestCacheStatsEvictions(t *testing.T) {
+	config := cache.NewConfig[string, int]().ByCount().MaxSize(80).ItemsToPrune(10)
+	cache := cache.New(config.Weigher(func(int) int { return 1 }))
+
+	for i := range 100 {
+		cache.Set("key"+strconv.Itoa(i), i, time.Minute)
+	}
+	time.Sleep(10 * time.Millisecond)
+
+	if evictions := cache.Stats().Evictions; evictions == 0 {
+		t.Errorf("Expected evictions to be counted, got %d", evictions)
+	}
+}
+
+func TestCacheShardStats(t *testing.T) {
+	cache := cache.New(cache.NewConfig[string, int]().ShardCounters())
+
+	for i := range 32 {
+		cache.Set("key"+strconv.Itoa(i), i, time.Minute)
+	}
+	for range 1000 {
+		cache.Get("hot")
+	}
+
+	var total, hottest int64
+	for _, s := range cache.ShardStats() {
+		total += s.Gets
+		hottest = max(hottest, s.Gets)
+	}
+
+	if total != 1000 {
+		t.Errorf("Expected 1000 gets across shards, got %d", total)
+	}
+
+	if hottest != 1000 {
+		t.Errorf("Expected the hot shard to serve all gets, got %d", hottest)
+	}
+
+	sets := int64(0)
+	for _, s := range cache.ShardStats() {
+		sets += s.Sets
+	}
+
+	if sets != 32 {
+		t.Errorf("Expected 32 sets across shards, got %d", sets)
+	}
+}
+
+func TestCacheGCObserver(t *testing.T) {
+	passes := make(chan cache.GCStats, 10)
+	config := cache.NewConfig[string, int]().MaxSize(10).ItemsToPrune(3).
+		Weigher(func(int) int { return 1 }).
+		GCObserver(func(stats cache.GCStats) { passes <- stats })
+	cache := cache.New(config)
+
+	for i := range 11 {
+		cache.Set("key"+strconv.Itoa(i), i, time.Minute)
+	}
+
+	select {
+	case stats := <-passes:
+		if stats.SizeBefore != 11 {
+			t.Errorf("Expected size before gc to be 11, got %d", stats.SizeBefore)
+		}
+		if stats.Evicted != 3 || stats.Examined != 3 {
+			t.Errorf("Expected 3 items to be examined and evicted, got %d and %d", stats.Examined, stats.Evicted)
+		}
+		if stats.SizeAfter != 8 {
+			t.Errorf("Expected size after gc to be 8, got %d", stats.SizeAfter)
+		}
+	case <-time.After(time.Second):
+		t.Fatalf("Expected the gc observer to be called")
+	}
+}
+
+func TestCacheWriteMetrics(t *testing.T) {
+	c := cache.New(cache.NewConfig[string, string]().ByCount().MaxSize(100).MetricsPrefix("sessions"))
+	c.Set("key1", "value1", time.Minute)
+	c.Set("key2", "value2", time.Minute)
+	c.Get("key1")
+	c.Get("key3")
+	c.Sync()
+
+	var out strings.Builder
+	if err := c.WriteMetrics(&out); err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+
+	samples := make(map[string]float64)
+	types := make(map[string]string)
+	for _, line := range strings.Split(strings.TrimSuffix(out.String(), "\n"), "\n") {
+		fields := strings.Fields(line)
+		switch {
+		case strings.HasPrefix(line, "# HELP "):
+		case strings.HasPrefix(line, "# TYPE ") && len(fields) == 4:
+			types[fields[2]] = fields[3]
+		case len(fields) == 2:
+			value, err := strconv.ParseFloat(fields[1], 64)
+			if err != nil {
+				t.Fatalf("Expected a numeric sample, got %q", line)
+			}
+			if _, ok := types[fields[0]]; !ok {
+				t.Errorf("Expected %s to be preceded by its type", fields[0])
+			}
+			samples[fields[0]] = value
+		default:
+			t.Fatalf("Expected a valid exposition line, got %q", line)
+		}
+	}
+
+	expected := map[string]float64{
+		"sessions_hits_total":        1,
+		"sessions_misses_total":      1,
+		"sessions_evictions_total":   0,
+		"sessions_expirations_total": 0,
+		"sessions_items":             2,
+		"sessions_size":              2,
+		"sessions_max_size":          100,
+	}
+	if !reflect.DeepEqual(samples, expected) {
+		t.Errorf("Expected samples %v, got %v", expected, samples)
+	}
+	if types["sessions_hits_total"] != "counter" || types["sessions_items"] != "gauge" {
+		t.Errorf("Expected counters and gauges to be typed, got %v", types)
+	}
+}
+
+func TestCachePublishExpvar(t *testing.T) {
+	c := cache.New(cache.NewConfig[string, string]().ByCount().MaxSize(100))
+	// Variables cannot be unpublished, so each run of the test needs its own name.
+	name := "TestCachePublishExpvar" + strconv.FormatInt(time.Now().UnixNano(), 10)
+	c.PublishExpvar(name)
+
+	c.Set("key1", "value1", time.Minute)
+	c.Get("key1")
+	c.Sync()
+
+	var published struct {
+		Hits      int64
+		ItemCount int
+		Size      int
+		MaxSize   int
+	}
+	if err := json.Unmarshal([]byte(expvar.Get(name).String()), &published); err != nil {
+		t.Fatalf("Expected the published stats to be JSON, got %v", err)
+	}
+	if published.Hits != 1 || published.ItemCount != 1 || published.Size != 1 || published.MaxSize != 100 {
+		t.Errorf("Expected the live stats to be published, got %+v", published)
+	}
+}
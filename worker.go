@@ -0,0 +1,276 @@
+package cache
+
+import (
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// worker owns the eviction policy and the size accounting of a disjoint set of shards.
+// Its goroutine is the only one using the policy, unless the workers are paused by Cache.do.
+// A cache has a single worker unless the configuration sets Workers.
+type worker[K comparable, V any] struct {
+	cache       *Cache[K, V]
+	shards      []*shard[K, V]
+	policy      policy[K, V]
+	size        atomic.Int64
+	deletables  chan deletion[K, V]
+	promotables chan promotion[K, V]
+	overflowMu  sync.Mutex
+	overflow    []deletion[K, V]
+	overflowed  chan struct{}
+	control     chan func()
+}
+
+func newWorker[K comparable, V any](c *Cache[K, V], shards []*shard[K, V]) *worker[K, V] {
+	return &worker[K, V]{
+		cache:       c,
+		shards:      shards,
+		policy:      newPolicy(c.Config, shards),
+		deletables:  make(chan deletion[K, V], c.deleteBuffer),
+		promotables: make(chan promotion[K, V], c.promoteBuffer),
+		overflowed:  make(chan struct{}, 1),
+		control:     make(chan func()),
+	}
+}
+
+func (w *worker[K, V]) run() {
+	c := w.cache
+	defer c.running.Done()
+	var reclaim <-chan struct{}
+	if c.budgetMember != nil {
+		reclaim = c.budgetMember.reclaim
+	}
+
+	var cleanup <-chan time.Time
+	if c.cleanupInterval > 0 {
+		ticker := time.NewTicker(c.cleanupInterval)
+		defer ticker.Stop()
+		cleanup = ticker.C
+	}
+
+	for {
+		select {
+		case d := <-w.deletables:
+			w.doDelete(d)
+		case <-w.overflowed:
+			w.drainOverflow()
+		case p := <-w.promotables:
+			w.track(p)
+		case <-cleanup:
+			w.deleteExpired()
+		case <-reclaim:
+			w.trimBudget()
+		case fn := <-w.control:
+			fn()
+		case <-c.done:
+			return
+		}
+	}
+}
+
+// track processes a promotion, making room if the new item grew the cache too much.
+func (w *worker[K, V]) track(p promotion[K, V]) {
+	if !w.doPromote(p) {
+		return
+	}
+	if w.cache.Size() > w.cache.MaxSizeValue() {
+		w.gc()
+	}
+	w.reclaimBudget()
+}
+
+func (w *worker[K, V]) doPromote(p promotion[K, V]) bool {
+	item := p.item
+	if item.promotions < 0 {
+		return false
+	}
+
+	if item.tracked {
+		w.policy.touch(item, p.force)
+		return false
+	}
+
+	w.grow(item.size)
+	item.tracked = true
+	w.policy.push(item)
+	return true
+}
+
+func (w *worker[K, V]) doDelete(d deletion[K, V]) {
+	if d.notify {
+		w.cache.evicted(d.item, d.reason)
+	}
+	w.cache.releaseWeight(d.item)
+	if d.item.tracked {
+		w.release(d.item)
+	} else {
+		d.item.promotions = -1
+	}
+}
+
+// release removes an item from the eviction policy and the size accounting.
+func (w *worker[K, V]) release(item *Item[K, V]) {
+	w.policy.remove(item)
+	item.tracked = false
+	item.promotions = -1
+	w.grow(-item.size)
+}
+
+// grow adjusts the size accounting of the worker, and of the cache's budget if any, by delta.
+func (w *worker[K, V]) grow(delta int) {
+	w.size.Add(int64(delta))
+	if c := w.cache; c.budget != nil {
+		c.budget.add(c.budgetMember, delta)
+	}
+}
+
+// discard hands a deletion to the worker without blocking. When the delete buffer is full,
+// the deletion is queued on an overflow list that the worker drains as soon as it can,
+// so deleting never stalls behind a busy worker at the cost of unbounded memory during bursts.
+func (w *worker[K, V]) discard(d deletion[K, V]) {
+	select {
+	case w.deletables <- d:
+		return
+	default:
+	}
+	w.overflowMu.Lock()
+	w.overflow = append(w.overflow, d)
+	w.overflowMu.Unlock()
+	select {
+	case w.overflowed <- struct{}{}:
+	default:
+	}
+}
+
+// drainOverflow processes the deletions queued while the delete buffer was full.
+func (w *worker[K, V]) drainOverflow() {
+	w.overflowMu.Lock()
+	pending := w.overflow
+	w.overflow = nil
+	w.overflowMu.Unlock()
+	for _, d := range pending {
+		w.doDelete(d)
+	}
+}
+
+// promote hands a promotion to the worker. It blocks until the worker has room for it,
+// or, with a configured PromoteTimeout, drops it once the timeout has passed. With sampled eviction
+// it never drops it, since Get does not promote and a dropped item would stay untracked forever.
+// Once the cache is closed, the worker is gone and the promotion is dropped.
+func (w *worker[K, V]) promote(p promotion[K, V]) {
+	c := w.cache
+	if c.promoteTimeout <= 0 || c.sampled() {
+		select {
+		case w.promotables <- p:
+		case <-c.done:
+		}
+		return
+	}
+	select {
+	case w.promotables <- p:
+		return
+	default:
+	}
+	timer := time.NewTimer(c.promoteTimeout)
+	defer timer.Stop()
+	select {
+	case w.promotables <- p:
+	case <-c.done:
+	case <-timer.C:
+		c.stats.droppedPromotions.Add(1)
+	}
+}
+
+// tryPromote hands a promotion for an accessed item to the worker without waiting,
+// dropping it if the worker is busy.
+func (w *worker[K, V]) tryPromote(item *Item[K, V]) {
+	select {
+	case w.promotables <- promotion[K, V]{item: item}:
+	default:
+		w.cache.stats.droppedPromotions.Add(1)
+	}
+}
+
+// drain processes every promotion and deletion queued for the worker, until none is left.
+func (w *worker[K, V]) drain() {
+	for {
+		select {
+		case d := <-w.deletables:
+			w.doDelete(d)
+		case p := <-w.promotables:
+			w.track(p)
+		default:
+			w.drainOverflow()
+			return
+		}
+	}
+}
+
+// deleteExpired removes every expired item from the worker's shards, one shard at a time.
+// It runs on the worker goroutine, so the removed items are released directly.
+func (w *worker[K, V]) deleteExpired() {
+	for _, s := range w.shards {
+		for _, item := range s.deleteExpired() {
+			w.cache.stats.expirations.Add(1)
+			w.doDelete(deletion[K, V]{item: item, notify: true, reason: Expired})
+		}
+	}
+}
+
+// gc prunes the items of the worker once the cache has grown over its max size: at least
+// the configured number of items to prune, and more until the size is back under the low watermark.
+// Sizes and item counts are not compared, as the size is in bytes unless the cache is ByCount.
+// The loop is bounded by the items of the worker, since every victim is evicted.
+func (w *worker[K, V]) gc() {
+	c := w.cache
+	start := time.Now()
+	sizeBefore := c.Size()
+	examined := 0
+	target := int(float64(c.MaxSizeValue()) * c.lowWatermark)
+
+	evicted := 0
+	for examined < c.itemsToPrune || c.Size() > target {
+		item := w.policy.victim()
+		if item == nil {
+			break
+		}
+
+		examined++
+		if w.evict(item) {
+			evicted++
+		}
+	}
+
+	if c.gcObserver != nil {
+		c.gcObserver(GCStats{
+			Examined:   examined,
+			Evicted:    evicted,
+			SizeBefore: sizeBefore,
+			SizeAfter:  c.Size(),
+			Duration:   time.Since(start),
+		})
+	}
+}
+
+// evict removes an item from the cache to make room, counting it as an eviction,
+// or as an expiration if it had already expired, and reports whether it removed it. An item that was
+// already replaced or deleted is only released: its pending deletion reports it, and the item now stored for its key stays.
+func (w *worker[K, V]) evict(item *Item[K, V]) bool {
+	c := w.cache
+	if !c.getShard(item.key).deleteItem(item) {
+		w.release(item)
+		return false
+	}
+	reason := Evicted
+	if item.Expired() {
+		reason = Expired
+		c.stats.expirations.Add(1)
+	} else {
+		c.stats.evictions.Add(1)
+	}
+	c.evicted(item, reason)
+	c.releaseWeight(item)
+	w.release(item)
+	return true
+}
@@ -0,0 +1,33 @@
+package cache
+
+import (
+	"strconv"
+	"testing"
+	"time"
+)
+
+func TestGCCountsOnlyRemovedVictims(t *testing.T) {
+	var passes []GCStats
+	c := New(NewConfig[string, int]().ByCount().MaxSize(10).ItemsToPrune(1).
+		GCObserver(func(stats GCStats) { passes = append(passes, stats) }))
+	for i := range 10 {
+		c.Set("key"+strconv.Itoa(i), i, time.Minute)
+	}
+	c.Sync()
+
+	c.do(func() {
+		// Replace the oldest item behind the worker's back, as if its deletion was still queued.
+		c.getShard("key0").set(c.allocItem("key0", 42, 0, 1))
+		c.workers[0].gc()
+	})
+
+	if len(passes) != 1 {
+		t.Fatalf("Expected 1 gc pass, got %d", len(passes))
+	}
+	if stats := passes[0]; stats.Examined != 1 || stats.Evicted != 0 {
+		t.Errorf("Expected 1 victim examined and none evicted, got %d and %d", stats.Examined, stats.Evicted)
+	}
+	if item := c.Peek("key0"); item == nil || item.Value() != 42 {
+		t.Errorf("Expected the replacement to stay in the cache")
+	}
+}